@@ -0,0 +1,679 @@
+package catlib
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	ArchiveFormatGNU  = "gnu"
+	ArchiveFormatBSD  = "bsd"
+	ArchiveFormatCOFF = "coff"
+	// not an archive, but an object file opened with OpenObject.
+	ArchiveFormatObject = "object"
+
+	ObjectFormatCOFF       = "COFF"
+	ObjectFormatCOFFImport = "COFF import"
+	ObjectFormatELF        = "ELF"
+	ObjectFormatMachO      = "Mach-O"
+	ObjectFormatBitcode    = "LLVM bitcode"
+)
+
+const (
+	IMAGE_SCN_CNT_CODE               = 0x00000020
+	IMAGE_SCN_CNT_UNINITIALIZED_DATA = 0x00000080
+	IMAGE_SCN_MEM_WRITE              = 0x80000000
+
+	IMPORT_OBJECT_CODE = 0
+
+	machoFatMagic          = 0xcafebabe
+	machoS_ZEROFILL        = 0x1
+	machoS_ATTR_SOME_INSTR = 0x00000400
+	machoS_ATTR_PURE_INSTR = 0x80000000
+)
+
+var coffMachineNames = map[uint16]string{
+	0x014c: "i386",
+	0x8664: "x86_64",
+	0x01c4: "arm",
+	0xaa64: "arm64",
+	0xa641: "arm64ec",
+	0xa64e: "arm64x",
+}
+
+var machoCpuNames = map[macho.Cpu]string{
+	macho.Cpu386:   "i386",
+	macho.CpuAmd64: "x86_64",
+	macho.CpuArm:   "arm",
+	macho.CpuArm64: "arm64",
+	macho.CpuPpc:   "ppc",
+	macho.CpuPpc64: "ppc64",
+}
+
+var elfMachineNames = map[elf.Machine]string{
+	elf.EM_386:     "i386",
+	elf.EM_X86_64:  "x86_64",
+	elf.EM_ARM:     "arm",
+	elf.EM_AARCH64: "aarch64",
+	elf.EM_RISCV:   "riscv",
+	elf.EM_PPC64:   "ppc64",
+	elf.EM_S390:    "s390",
+}
+
+// Archive reads static libraries and object files of any format (COFF, ELF
+// and Mach-O, including universal binaries) in pure Go. Unlike LibFile, it
+// does not depend on the host tools, so libraries can be inspected on any
+// host.
+type Archive struct {
+	ILibFile
+	filePath    string
+	format      string
+	symbolTable bool
+	arches      []string
+	members     []*archiveMember
+}
+
+type archiveMember struct {
+	name   string
+	data   []byte
+	object objectInfo
+}
+
+type objectInfo struct {
+	// one of ObjectFormat* constants, or empty for unknown contents.
+	format     string
+	arch       string
+	symbols    []ArchiveSymbol
+	sections   []string
+	directives []Directive
+	// true when the symbols are not readable, such as LLVM bitcode and
+	// anonymous COFF objects.
+	opaque bool
+}
+
+// ArchiveSymbol is an external symbol of a member read by Archive.
+type ArchiveSymbol struct {
+	ISymbol
+	name string
+	// nm style symbol type: 'U' (undefined), 'T' (code), 'D' (data), 'B'
+	// (uninitialized data), 'R' (read-only data), 'C' (common), 'A'
+	// (absolute), 'I' (indirect), 'W' (weak definition) or 'w' (weak
+	// reference).
+	kind byte
+	weak bool
+	// true for Mach-O private extern symbols, which are visible only within
+	// the linkage unit. Tools differ in whether symbol tables have them.
+	privateExtern bool
+}
+
+func (this *ArchiveSymbol) Name() string {
+	return this.name
+}
+
+func (this *ArchiveSymbol) Kind() byte {
+	return this.kind
+}
+
+func (this *ArchiveSymbol) IsImportSymbol() bool {
+	return this.kind == 'U'
+}
+
+func (this *ArchiveSymbol) IsExportSymbol() bool {
+	return this.kind != 'U' && this.kind != 'w'
+}
+
+func (this *ArchiveSymbol) IsWeak() bool {
+	return this.weak
+}
+
+// Open reads a static library. For universal binaries, the slice of arch is
+// read. arch may be empty when the file has only one slice.
+func (this *Archive) Open(filePath string, arch string) error {
+	this.filePath = filePath
+	data, err := this.readFile(filePath, arch)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte("!<thin>\n")) {
+		return fmt.Errorf("thin archives are not supported")
+	}
+	if !bytes.HasPrefix(data, []byte("!<arch>\n")) {
+		return fmt.Errorf("not a static library")
+	}
+	return this.readMembers(data)
+}
+
+// OpenObject opens an object file as a library which has single member.
+func (this *Archive) OpenObject(filePath string, arch string) error {
+	this.filePath = filePath
+	data, err := this.readFile(filePath, arch)
+	if err != nil {
+		return err
+	}
+	this.format = ArchiveFormatObject
+	m := new(archiveMember)
+	m.name = filepath.Base(filePath)
+	m.data = data
+	m.object = readObjectInfo(data)
+	this.members = append(this.members, m)
+	return nil
+}
+
+// readFile reads the file, or the slice of arch if it is a universal binary.
+func (this *Archive) readFile(filePath string, arch string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	slices, err := readUniversalSlices(data)
+	if err != nil || slices == nil {
+		return data, err
+	}
+	for _, slice := range slices {
+		this.arches = append(this.arches, slice.arch)
+	}
+	for _, slice := range slices {
+		if slice.arch == arch || (arch == "" && len(slices) == 1) {
+			return slice.data, nil
+		}
+	}
+	if arch == "" {
+		return nil, fmt.Errorf("universal binary has %s slices, architecture has to be specified", strings.Join(this.arches, ", "))
+	}
+	return nil, fmt.Errorf("universal binary has no '%s' slice, but %s", arch, strings.Join(this.arches, ", "))
+}
+
+type universalSlice struct {
+	arch string
+	data []byte
+}
+
+// readUniversalSlices returns slices of a Mach-O universal binary, or nil
+// when the data is not a universal binary.
+func readUniversalSlices(data []byte) ([]universalSlice, error) {
+	if len(data) < 8 || binary.BigEndian.Uint32(data) != machoFatMagic {
+		return nil, nil
+	}
+	n := int(binary.BigEndian.Uint32(data[4:]))
+	if 8+n*20 > len(data) {
+		return nil, fmt.Errorf("universal binary header out of range")
+	}
+	ret := []universalSlice{}
+	for i := 0; i < n; i++ {
+		header := data[8+i*20:]
+		cpu := macho.Cpu(binary.BigEndian.Uint32(header[0:4]))
+		offset := int(binary.BigEndian.Uint32(header[8:12]))
+		size := int(binary.BigEndian.Uint32(header[12:16]))
+		if offset+size > len(data) {
+			return nil, fmt.Errorf("slice %d of universal binary out of range", i)
+		}
+		arch, ok := machoCpuNames[cpu]
+		if !ok {
+			arch = fmt.Sprintf("cpu%d", uint32(cpu))
+		}
+		ret = append(ret, universalSlice{arch, data[offset : offset+size]})
+	}
+	return ret, nil
+}
+
+// UniversalArches returns architectures of a Mach-O universal binary, or nil
+// when the file is not a universal binary.
+func UniversalArches(filePath string) ([]string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	slices, err := readUniversalSlices(data)
+	if err != nil || slices == nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, slice := range slices {
+		ret = append(ret, slice.arch)
+	}
+	return ret, nil
+}
+
+// readMembers reads members of GNU (System V), BSD and COFF archives. Symbol
+// tables and long name tables are not members.
+func (this *Archive) readMembers(data []byte) error {
+	this.format = ArchiveFormatGNU
+	longNames := []byte{}
+	linkerMembers := 0
+	offset := 8
+	for offset < len(data) {
+		if data[offset] == '\n' {
+			// padding
+			offset++
+			continue
+		}
+		if offset+60 > len(data) || string(data[offset+58:offset+60]) != "`\n" {
+			return fmt.Errorf("invalid member header at offset %d", offset)
+		}
+		header := data[offset : offset+60]
+		name := strings.TrimRight(string(header[0:16]), " ")
+		size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+		if err != nil || size < 0 || offset+60+size > len(data) {
+			return fmt.Errorf("invalid member size at offset %d", offset)
+		}
+		contents := data[offset+60 : offset+60+size]
+		offset += 60 + size + size%2
+
+		switch {
+		case name == "/" || name == "/SYM64/":
+			linkerMembers++
+			this.symbolTable = true
+			if linkerMembers == 2 {
+				this.format = ArchiveFormatCOFF
+			}
+			continue
+		case name == "//":
+			longNames = contents
+			continue
+		case strings.HasPrefix(name, "/<"):
+			// ARM64EC symbol tables, such as '/<ECSYMBOLS>/'.
+			continue
+		case strings.HasPrefix(name, "#1/"):
+			this.format = ArchiveFormatBSD
+			n, err := strconv.Atoi(name[3:])
+			if err != nil || n > len(contents) {
+				return fmt.Errorf("invalid member name '%s'", name)
+			}
+			name = string(bytes.TrimRight(contents[:n], "\x00"))
+			contents = contents[n:]
+		case strings.HasPrefix(name, "/"):
+			n, err := strconv.Atoi(name[1:])
+			if err != nil || n >= len(longNames) {
+				return fmt.Errorf("invalid member name '%s'", name)
+			}
+			name = archiveLongName(longNames[n:])
+		default:
+			name = strings.TrimSuffix(name, "/")
+		}
+		if strings.HasPrefix(name, "__.SYMDEF") {
+			this.format = ArchiveFormatBSD
+			this.symbolTable = true
+			continue
+		}
+
+		m := new(archiveMember)
+		m.name = name
+		m.data = contents
+		m.object = readObjectInfo(contents)
+		this.members = append(this.members, m)
+	}
+	return nil
+}
+
+// archiveLongName returns a name in the long name table, which ends with
+// "/\n" in GNU archives, or NUL in COFF archives.
+func archiveLongName(table []byte) string {
+	if i := bytes.IndexAny(table, "\n\x00"); i >= 0 {
+		table = table[:i]
+	}
+	return strings.TrimSuffix(string(table), "/")
+}
+
+func (this *Archive) Close() {
+}
+
+// Format returns one of ArchiveFormat* constants.
+func (this *Archive) Format() string {
+	return this.format
+}
+
+// HasSymbolTable returns true when the archive has a symbol table, which
+// linkers need to search its members.
+func (this *Archive) HasSymbolTable() bool {
+	return this.symbolTable
+}
+
+// Arches returns architectures of the universal binary, or nil when the file
+// is not a universal binary.
+func (this *Archive) Arches() []string {
+	return this.arches
+}
+
+func (this *Archive) NumMembers() int {
+	return len(this.members)
+}
+
+func (this *Archive) MemberName(memberIndex int) string {
+	return this.members[memberIndex].name
+}
+
+func (this *Archive) MemberSize(memberIndex int) int64 {
+	return int64(len(this.members[memberIndex].data))
+}
+
+// ObjectFormat returns one of ObjectFormat* constants, or empty string when
+// the member is not an object file.
+func (this *Archive) ObjectFormat(memberIndex int) string {
+	return this.members[memberIndex].object.format
+}
+
+func (this *Archive) Arch(memberIndex int) string {
+	return this.members[memberIndex].object.arch
+}
+
+func (this *Archive) Extract(memberIndex int, w io.Writer) error {
+	_, err := w.Write(this.members[memberIndex].data)
+	return err
+}
+
+// Symbols returns external symbols of the member, both defined and
+// undefined.
+func (this *Archive) Symbols(memberIndex int) []ArchiveSymbol {
+	return this.members[memberIndex].object.symbols
+}
+
+// ImportSymbols returns undefined symbols of the member, excluding ones
+// defined by the member itself.
+func (this *Archive) ImportSymbols(memberIndex int) []ISymbol {
+	symbols := this.members[memberIndex].object.symbols
+	exported := NewStringSet()
+	for i := range symbols {
+		if symbols[i].IsExportSymbol() {
+			exported.Put(symbols[i].name)
+		}
+	}
+	ret := []ISymbol{}
+	for i := range symbols {
+		if symbols[i].IsImportSymbol() && !exported.Has(symbols[i].name) {
+			ret = append(ret, &symbols[i])
+		}
+	}
+	return ret
+}
+
+func (this *Archive) ExportSymbols(memberIndex int) []ISymbol {
+	symbols := this.members[memberIndex].object.symbols
+	ret := []ISymbol{}
+	for i := range symbols {
+		if symbols[i].IsExportSymbol() {
+			ret = append(ret, &symbols[i])
+		}
+	}
+	return ret
+}
+
+func (this *Archive) Sections(memberIndex int) []string {
+	return this.members[memberIndex].object.sections
+}
+
+func (this *Archive) Directives(memberIndex int) []Directive {
+	return this.members[memberIndex].object.directives
+}
+
+// readObjectInfo reads symbols and sections of an object file. The result
+// has empty format when the data is not an object file of known format.
+func readObjectInfo(data []byte) objectInfo {
+	var info objectInfo
+	switch {
+	case bytes.HasPrefix(data, []byte("\x7fELF")):
+		readELFObjectInfo(data, &info)
+	case isMachO(data):
+		readMachOObjectInfo(data, &info)
+	case bytes.HasPrefix(data, []byte("BC\xc0\xde")):
+		info.format = ObjectFormatBitcode
+		info.opaque = true
+	case len(data) >= 20 && binary.LittleEndian.Uint16(data[0:2]) == 0 && binary.LittleEndian.Uint16(data[2:4]) == 0xffff:
+		if binary.LittleEndian.Uint16(data[4:6]) == 0 {
+			readCOFFImportObjectInfo(data, &info)
+		} else if len(data) >= 56 && bytes.Equal(data[12:28], bigobjClassID) {
+			readCOFFObjectInfo(data, &info)
+		} else {
+			// anonymous objects such as LTCG (/GL) objects. Their
+			// symbols are not readable.
+			info.format = ObjectFormatCOFF
+			info.arch = coffMachineNames[binary.LittleEndian.Uint16(data[6:8])]
+			info.opaque = true
+		}
+	case len(data) >= 20:
+		if _, ok := coffMachineNames[binary.LittleEndian.Uint16(data[0:2])]; ok {
+			readCOFFObjectInfo(data, &info)
+		}
+	}
+	if info.symbols == nil {
+		info.symbols = []ArchiveSymbol{}
+	}
+	if info.sections == nil {
+		info.sections = []string{}
+	}
+	if info.directives == nil {
+		info.directives = []Directive{}
+	}
+	return info
+}
+
+func readCOFFObjectInfo(data []byte, info *objectInfo) {
+	obj, err := ReadCOFFObject(data)
+	if err != nil {
+		// COFFObject rejects objects with broken relocations, which are
+		// still readable by debug/pe.
+		if obj, err = readCOFFObjectSymbols(data); err != nil {
+			return
+		}
+	}
+	info.format = ObjectFormatCOFF
+	info.arch = coffMachineNames[obj.Machine]
+	for _, section := range obj.Sections {
+		info.sections = append(info.sections, section.Name)
+	}
+	if section := obj.Section(".drectve"); section != nil && section.Data != nil {
+		info.directives = ParseDirectives(section.Data)
+	}
+	for _, sym := range obj.Symbols {
+		s := ArchiveSymbol{name: sym.Name}
+		switch {
+		case sym.StorageClass == IMAGE_SYM_CLASS_WEAK_EXTERNAL && sym.weakDefault != nil && sym.weakDefault.Section != nil:
+			// weak definition, such as '__attribute__((weak))' of clang,
+			// whose default symbol is defined in the object.
+			s.kind = 'W'
+			s.weak = true
+		case sym.StorageClass == IMAGE_SYM_CLASS_WEAK_EXTERNAL:
+			s.kind = 'w'
+		case sym.StorageClass != IMAGE_SYM_CLASS_EXTERNAL:
+			continue
+		case sym.Section != nil:
+			s.kind = coffSectionKind(sym.Section.Characteristics)
+			s.weak = sym.Section.Characteristics&IMAGE_SCN_LNK_COMDAT != 0
+		case sym.SectionNumber == IMAGE_SYM_UNDEFINED && sym.Value == 0:
+			s.kind = 'U'
+		case sym.SectionNumber == IMAGE_SYM_UNDEFINED:
+			s.kind = 'C'
+			s.weak = true
+		default:
+			s.kind = 'A'
+		}
+		info.symbols = append(info.symbols, s)
+	}
+}
+
+// readCOFFObjectSymbols reads sections and symbols of a regular COFF object
+// with debug/pe. Relocations and contents other than '.drectve' are not
+// read.
+func readCOFFObjectSymbols(data []byte) (*COFFObject, error) {
+	f, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	obj := new(COFFObject)
+	obj.Machine = f.Machine
+	for _, s := range f.Sections {
+		section := new(COFFSection)
+		section.Name = s.Name
+		section.Characteristics = s.Characteristics
+		if s.Name == ".drectve" {
+			section.Data, _ = s.Data()
+		}
+		obj.Sections = append(obj.Sections, section)
+	}
+	for _, s := range f.Symbols {
+		sym := new(COFFSymbol)
+		sym.Name = s.Name
+		sym.Value = s.Value
+		sym.SectionNumber = int32(s.SectionNumber)
+		if s.SectionNumber > 0 && int(s.SectionNumber) <= len(obj.Sections) {
+			sym.Section = obj.Sections[s.SectionNumber-1]
+		}
+		sym.StorageClass = s.StorageClass
+		obj.Symbols = append(obj.Symbols, sym)
+	}
+	return obj, nil
+}
+
+func coffSectionKind(characteristics uint32) byte {
+	switch {
+	case characteristics&IMAGE_SCN_CNT_CODE != 0:
+		return 'T'
+	case characteristics&IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0:
+		return 'B'
+	case characteristics&IMAGE_SCN_MEM_WRITE != 0:
+		return 'D'
+	}
+	return 'R'
+}
+
+// readCOFFImportObjectInfo reads a short import object of an import library,
+// which defines '__imp_name', and 'name' for code.
+func readCOFFImportObjectInfo(data []byte, info *objectInfo) {
+	info.format = ObjectFormatCOFFImport
+	info.arch = coffMachineNames[binary.LittleEndian.Uint16(data[6:8])]
+	name, err := cString(data[20:], 0)
+	if err != nil {
+		return
+	}
+	info.symbols = append(info.symbols, ArchiveSymbol{name: "__imp_" + name, kind: 'D'})
+	if binary.LittleEndian.Uint16(data[18:20])&0x3 == IMPORT_OBJECT_CODE {
+		info.symbols = append(info.symbols, ArchiveSymbol{name: name, kind: 'T'})
+	}
+}
+
+func readELFObjectInfo(data []byte, info *objectInfo) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info.format = ObjectFormatELF
+	info.arch = elfMachineNames[f.Machine]
+	if info.arch == "" {
+		info.arch = strings.ToLower(strings.TrimPrefix(f.Machine.String(), "EM_"))
+	}
+	for _, section := range f.Sections {
+		info.sections = append(info.sections, section.Name)
+	}
+	symbols, _ := f.Symbols()
+	for _, sym := range symbols {
+		bind := elf.ST_BIND(sym.Info)
+		typ := elf.ST_TYPE(sym.Info)
+		if bind == elf.STB_LOCAL || typ == elf.STT_FILE || typ == elf.STT_SECTION || sym.Name == "" {
+			continue
+		}
+		s := ArchiveSymbol{name: sym.Name, weak: bind == elf.STB_WEAK}
+		switch {
+		case sym.Section == elf.SHN_UNDEF && s.weak:
+			s.kind = 'w'
+		case sym.Section == elf.SHN_UNDEF:
+			s.kind = 'U'
+		case sym.Section == elf.SHN_COMMON:
+			s.kind = 'C'
+			s.weak = true
+		case sym.Section == elf.SHN_ABS:
+			s.kind = 'A'
+		case s.weak:
+			s.kind = 'W'
+		case int(sym.Section) < len(f.Sections):
+			s.kind = elfSectionKind(f.Sections[sym.Section])
+		default:
+			s.kind = 'A'
+		}
+		info.symbols = append(info.symbols, s)
+	}
+}
+
+func elfSectionKind(section *elf.Section) byte {
+	switch {
+	case section.Flags&elf.SHF_EXECINSTR != 0:
+		return 'T'
+	case section.Type == elf.SHT_NOBITS:
+		return 'B'
+	case section.Flags&elf.SHF_WRITE != 0:
+		return 'D'
+	}
+	return 'R'
+}
+
+func readMachOObjectInfo(data []byte, info *objectInfo) {
+	f, err := macho.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info.format = ObjectFormatMachO
+	info.arch = machoCpuNames[f.Cpu]
+	for _, section := range f.Sections {
+		info.sections = append(info.sections, section.Name)
+	}
+	if f.Symtab == nil {
+		return
+	}
+	for _, sym := range f.Symtab.Syms {
+		if sym.Type&machoN_STAB != 0 || sym.Type&machoN_EXT == 0 {
+			continue
+		}
+		s := ArchiveSymbol{name: sym.Name, privateExtern: sym.Type&machoN_PEXT != 0}
+		switch sym.Type & machoN_TYPE {
+		case machoN_UNDF:
+			switch {
+			case sym.Value != 0:
+				s.kind = 'C'
+				s.weak = true
+			case sym.Desc&machoN_WEAK_REF != 0:
+				s.kind = 'w'
+			default:
+				s.kind = 'U'
+			}
+		case machoN_ABS:
+			s.kind = 'A'
+		case machoN_INDR:
+			s.kind = 'I'
+		case machoN_SECT:
+			switch {
+			case sym.Desc&machoN_WEAK_DEF != 0:
+				s.kind = 'W'
+				s.weak = true
+			case sym.Sect > 0 && int(sym.Sect) <= len(f.Sections):
+				s.kind = machoSectionKind(f.Sections[sym.Sect-1])
+			default:
+				s.kind = 'A'
+			}
+		default:
+			continue
+		}
+		info.symbols = append(info.symbols, s)
+	}
+}
+
+func machoSectionKind(section *macho.Section) byte {
+	switch {
+	case section.Flags&(machoS_ATTR_PURE_INSTR|machoS_ATTR_SOME_INSTR) != 0:
+		return 'T'
+	case section.Flags&0xff == machoS_ZEROFILL:
+		return 'B'
+	case strings.HasPrefix(section.Seg, "__DATA"):
+		return 'D'
+	}
+	return 'R'
+}
@@ -0,0 +1,221 @@
+package catlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readTestData(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// openArchiveData writes data into a temporary file, and opens it.
+func openArchiveData(t *testing.T, data []byte) *Archive {
+	filePath := filepath.Join(t.TempDir(), "lib.a")
+	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := new(Archive)
+	if err := a.Open(filePath, ""); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func archiveExports(a *Archive, memberIndex int) []string {
+	ret := []string{}
+	for _, sym := range a.ExportSymbols(memberIndex) {
+		ret = append(ret, sym.Name())
+	}
+	return ret
+}
+
+// members with a name longer than 15 characters, which needs the long name
+// table of GNU and COFF archives, and an odd size, which needs padding.
+func TestWriteArchive(t *testing.T) {
+	tests := []struct {
+		format string
+		object string
+		export string
+	}{
+		{ArchiveFormatGNU, "deplibs.o", "f"},
+		{ArchiveFormatCOFF, "gcc-amd64-mingw-bigobj.obj", "main"},
+		{ArchiveFormatBSD, "linker_option.o", "_f"},
+	}
+	for _, test := range tests {
+		object := readTestData(t, test.object)
+		members := []ArchiveMember{
+			{"a_very_long_member_name.o", append(append([]byte{}, object...), 0)},
+			{"b.o", object},
+		}
+		if got := DefaultArchiveFormat(members); got != test.format {
+			t.Errorf("default format of %s is %s, want %s", test.object, got, test.format)
+		}
+		data, err := WriteArchive(members, test.format)
+		if err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+		problems, err := verifyArchiveData(data)
+		if err != nil || len(problems) > 0 {
+			t.Errorf("%s: broken archive: %q %v", test.format, problems, err)
+		}
+
+		a := openArchiveData(t, data)
+		if a.Format() != test.format || !a.HasSymbolTable() {
+			t.Errorf("%s: read as %s, symbol table %v", test.format, a.Format(), a.HasSymbolTable())
+		}
+		if a.NumMembers() != len(members) {
+			t.Fatalf("%s: %d members, want %d", test.format, a.NumMembers(), len(members))
+		}
+		for i, m := range members {
+			var buf bytes.Buffer
+			if err := a.Extract(i, &buf); err != nil {
+				t.Fatal(err)
+			}
+			if a.MemberName(i) != m.Name || !bytes.Equal(buf.Bytes(), m.Data) {
+				t.Errorf("%s: member #%d is '%s' of %d bytes, want '%s' of %d bytes", test.format, i, a.MemberName(i), buf.Len(), m.Name, len(m.Data))
+			}
+			if got := archiveExports(a, i); !reflect.DeepEqual(got, []string{test.export}) {
+				t.Errorf("%s: member #%d exports %q, want %q", test.format, i, got, test.export)
+			}
+		}
+	}
+}
+
+func TestWriteArchiveLongNames(t *testing.T) {
+	object := readTestData(t, "deplibs.o")
+	members := []ArchiveMember{
+		{"exactly15chars.", object},
+		{"exactly16chars.o", object},
+		{"a_very_long_member_name.o", object},
+	}
+	data, err := WriteArchive(members, ArchiveFormatGNU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("exactly16chars.o/\na_very_long_member_name.o/\n")) {
+		t.Errorf("long name table not found")
+	}
+	a := openArchiveData(t, data)
+	for i, m := range members {
+		if a.MemberName(i) != m.Name {
+			t.Errorf("member #%d is '%s', want '%s'", i, a.MemberName(i), m.Name)
+		}
+	}
+}
+
+// GNU archives use '/SYM64/' symbol table with 64 bit offsets instead of '/'
+// when the archive is larger than 4GB, or when written by 'ar --format=gnu64'.
+func TestArchiveSYM64(t *testing.T) {
+	object := readTestData(t, "deplibs.o")
+	objectOffset := 8 + 60 + 8 + 8 + 2
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	index := make([]byte, 16)
+	binary.BigEndian.PutUint64(index[0:], 1)
+	binary.BigEndian.PutUint64(index[8:], uint64(objectOffset))
+	writeArchiveMember(&buf, "/SYM64/", 0, append(index, "f\x00"...))
+	if buf.Len() != objectOffset {
+		t.Fatalf("object offset %d, want %d", buf.Len(), objectOffset)
+	}
+	writeArchiveMember(&buf, "f.o/", 0644, object)
+
+	problems, err := verifyArchiveData(buf.Bytes())
+	if err != nil || len(problems) > 0 {
+		t.Errorf("broken archive: %q %v", problems, err)
+	}
+	a := openArchiveData(t, buf.Bytes())
+	if a.Format() != ArchiveFormatGNU || !a.HasSymbolTable() {
+		t.Errorf("read as %s, symbol table %v", a.Format(), a.HasSymbolTable())
+	}
+	if a.NumMembers() != 1 || a.MemberName(0) != "f.o" {
+		t.Fatalf("%d members, want 'f.o' only", a.NumMembers())
+	}
+	if got := archiveExports(a, 0); !reflect.DeepEqual(got, []string{"f"}) {
+		t.Errorf("exports %q, want [f]", got)
+	}
+}
+
+// '__.SYMDEF' is the first member of BSD archives, and not read as a member.
+func TestArchiveBSDSymbolTable(t *testing.T) {
+	object := readTestData(t, "linker_option.o")
+	data, err := WriteArchive([]ArchiveMember{{"x.o", object}}, ArchiveFormatBSD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data[8+60:], []byte("__.SYMDEF\x00")) {
+		t.Errorf("'__.SYMDEF' is not the first member")
+	}
+	a := openArchiveData(t, data)
+	if a.Format() != ArchiveFormatBSD || !a.HasSymbolTable() {
+		t.Errorf("read as %s, symbol table %v", a.Format(), a.HasSymbolTable())
+	}
+	if a.NumMembers() != 1 || a.MemberName(0) != "x.o" {
+		t.Errorf("%d members, want 'x.o' only", a.NumMembers())
+	}
+}
+
+// weakExternalObject returns a COFF object, which defines 'w' as a weak
+// external with '.weak.w.default' as its default, like clang does for
+// '__attribute__((weak))', and references 'u' weakly.
+func weakExternalObject() []byte {
+	obj := &COFFObject{Machine: 0x8664}
+	text := &COFFSection{Name: ".text", Data: []byte{0xc3}, Characteristics: 0x60500020}
+	obj.Sections = append(obj.Sections, text)
+	weakDefault := &COFFSymbol{Name: ".weak.w.default", Section: text, Type: 0x20, StorageClass: IMAGE_SYM_CLASS_EXTERNAL}
+	undefinedDefault := &COFFSymbol{Name: ".weak.u.default", Type: 0x20, StorageClass: IMAGE_SYM_CLASS_EXTERNAL}
+	// characteristics of the aux records are IMAGE_WEAK_EXTERN_SEARCH_ALIAS.
+	aux := []byte{0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	obj.Symbols = append(obj.Symbols, weakDefault, undefinedDefault,
+		&COFFSymbol{Name: "w", Type: 0x20, StorageClass: IMAGE_SYM_CLASS_WEAK_EXTERNAL, Aux: [][]byte{aux}, weakDefault: weakDefault},
+		&COFFSymbol{Name: "u", Type: 0x20, StorageClass: IMAGE_SYM_CLASS_WEAK_EXTERNAL, Aux: [][]byte{aux}, weakDefault: undefinedDefault})
+	data, err := obj.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// weak externals with a defined default are definitions.
+func TestReadWeakExternals(t *testing.T) {
+	object := weakExternalObject()
+	if got, want := sortedSymbols(readObjectInfo(object)), []string{"T .weak.w.default", "U .weak.u.default", "W w", "w u"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("%q, want %q", got, want)
+	}
+	data, err := WriteArchive([]ArchiveMember{{"weak.obj", object}}, ArchiveFormatCOFF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := openArchiveData(t, data)
+	defer a.Close()
+	if got, want := archiveExports(a, 0), []string{".weak.w.default", "w"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exports %q, want %q", got, want)
+	}
+	for _, sym := range a.ExportSymbols(0) {
+		if sym.Name() == "w" && !sym.IsWeak() {
+			t.Errorf("'w' is not weak")
+		}
+	}
+}
+
+// member indices of the second linker member are 16 bit.
+func TestWriteArchiveTooManyMembers(t *testing.T) {
+	members := make([]ArchiveMember, 0x10000)
+	for i := range members {
+		members[i] = ArchiveMember{"x.obj", []byte{0}}
+	}
+	if _, err := WriteArchive(members, ArchiveFormatCOFF); err == nil {
+		t.Errorf("COFF archive of %d members is written", len(members))
+	}
+	if _, err := WriteArchive(members[:0xffff], ArchiveFormatCOFF); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,211 @@
+package catlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// ArchiveMember is a member written by WriteArchive.
+type ArchiveMember struct {
+	Name string
+	Data []byte
+}
+
+// DefaultArchiveFormat returns the archive format native to the members:
+// ArchiveFormatBSD for Mach-O, ArchiveFormatCOFF for COFF, and
+// ArchiveFormatGNU for the others.
+func DefaultArchiveFormat(members []ArchiveMember) string {
+	for _, m := range members {
+		switch readObjectInfo(m.Data).format {
+		case ObjectFormatMachO:
+			return ArchiveFormatBSD
+		case ObjectFormatCOFF, ObjectFormatCOFFImport:
+			return ArchiveFormatCOFF
+		case ObjectFormatELF:
+			return ArchiveFormatGNU
+		}
+	}
+	return ArchiveFormatGNU
+}
+
+// WriteArchive returns a static library of the format (one of
+// ArchiveFormatGNU, ArchiveFormatBSD or ArchiveFormatCOFF), with a symbol
+// table of symbols defined by the members. Timestamps and owners are zero,
+// so the output is deterministic.
+func WriteArchive(members []ArchiveMember, format string) ([]byte, error) {
+	type entry struct {
+		name   string
+		member int
+	}
+	symbols := []entry{}
+	for i, m := range members {
+		for _, sym := range readObjectInfo(m.Data).symbols {
+			if sym.IsExportSymbol() {
+				symbols = append(symbols, entry{sym.name, i})
+			}
+		}
+	}
+	names := []byte{}
+	for _, sym := range symbols {
+		names = append(append(names, sym.name...), 0)
+	}
+
+	switch format {
+	case ArchiveFormatGNU, ArchiveFormatCOFF:
+		// the second linker member has 16 bit member indices.
+		if format == ArchiveFormatCOFF && len(members) > 0xffff {
+			return nil, fmt.Errorf("too many members for COFF archive: %d", len(members))
+		}
+		// long name table, referred by '/offset' member names.
+		longNames := []byte{}
+		memberNames := make([]string, len(members))
+		for i, m := range members {
+			if len(m.Name) < 16 {
+				memberNames[i] = m.Name + "/"
+				continue
+			}
+			memberNames[i] = fmt.Sprintf("/%d", len(longNames))
+			if format == ArchiveFormatGNU {
+				longNames = append(append(longNames, m.Name...), '/', '\n')
+			} else {
+				longNames = append(append(longNames, m.Name...), 0)
+			}
+		}
+
+		firstSize := 4 + 4*len(symbols) + len(names)
+		secondSize := 4 + 4*len(members) + 4 + 2*len(symbols) + len(names)
+		offset := 8 + 60 + firstSize + firstSize%2
+		if format == ArchiveFormatCOFF {
+			offset += 60 + secondSize + secondSize%2
+		}
+		if len(longNames) > 0 {
+			offset += 60 + len(longNames) + len(longNames)%2
+		}
+		offsets := make([]int, len(members))
+		for i, m := range members {
+			offsets[i] = offset
+			offset += 60 + len(m.Data) + len(m.Data)%2
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString("!<arch>\n")
+
+		// first linker member: big endian offsets in member order.
+		first := make([]byte, 4+4*len(symbols), firstSize)
+		binary.BigEndian.PutUint32(first, uint32(len(symbols)))
+		for i, sym := range symbols {
+			binary.BigEndian.PutUint32(first[4+4*i:], uint32(offsets[sym.member]))
+		}
+		writeArchiveMember(&buf, "/", 0, append(first, names...))
+
+		if format == ArchiveFormatCOFF {
+			// second linker member: little endian, sorted by name.
+			sorted := append([]entry{}, symbols...)
+			sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+			second := make([]byte, secondSize-len(names), secondSize)
+			binary.LittleEndian.PutUint32(second, uint32(len(members)))
+			for i, o := range offsets {
+				binary.LittleEndian.PutUint32(second[4+4*i:], uint32(o))
+			}
+			p := 4 + 4*len(members)
+			binary.LittleEndian.PutUint32(second[p:], uint32(len(sorted)))
+			for i, sym := range sorted {
+				binary.LittleEndian.PutUint16(second[p+4+2*i:], uint16(sym.member+1))
+			}
+			for _, sym := range sorted {
+				second = append(append(second, sym.name...), 0)
+			}
+			writeArchiveMember(&buf, "/", 0, second)
+		}
+		if len(longNames) > 0 {
+			writeArchiveMember(&buf, "//", 0, longNames)
+		}
+		for i, m := range members {
+			writeArchiveMember(&buf, memberNames[i], 0644, m.Data)
+		}
+		return buf.Bytes(), nil
+
+	case ArchiveFormatBSD:
+		var buf bytes.Buffer
+		buf.WriteString("!<arch>\n")
+
+		// '__.SYMDEF' has ranlib structures {string offset, member offset},
+		// followed by the string table. The offsets are patched after the
+		// members are written.
+		symdef := make([]byte, 4+8*len(symbols)+4, 4+8*len(symbols)+4+len(names))
+		binary.LittleEndian.PutUint32(symdef, uint32(8*len(symbols)))
+		stringOffset := 0
+		for i, sym := range symbols {
+			binary.LittleEndian.PutUint32(symdef[4+8*i:], uint32(stringOffset))
+			stringOffset += len(sym.name) + 1
+		}
+		binary.LittleEndian.PutUint32(symdef[4+8*len(symbols):], uint32(len(names)))
+		symdef = append(symdef, names...)
+		symdefOffset := writeBSDArchiveMember(&buf, "__.SYMDEF", 0, symdef)
+
+		offsets := make([]int, len(members))
+		for i, m := range members {
+			offsets[i] = buf.Len()
+			writeBSDArchiveMember(&buf, m.Name, 0644, m.Data)
+		}
+		ret := buf.Bytes()
+		for i, sym := range symbols {
+			binary.LittleEndian.PutUint32(ret[symdefOffset+8+8*i:], uint32(offsets[sym.member]))
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("unknown archive format '%s'", format)
+}
+
+func writeArchiveMember(buf *bytes.Buffer, name string, mode int, data []byte) {
+	fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 0, 0, 0, mode, len(data))
+	buf.Write(data)
+	if len(data)%2 != 0 {
+		buf.WriteByte('\n')
+	}
+}
+
+// writeBSDArchiveMember writes a member with '#1/length' name, which is
+// padded so that the data is 8 byte aligned. It returns the offset of the
+// data.
+func writeBSDArchiveMember(buf *bytes.Buffer, name string, mode int, data []byte) int {
+	nameSize := len(name) + 1
+	for (buf.Len()+60+nameSize)%8 != 0 {
+		nameSize++
+	}
+	fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", fmt.Sprintf("#1/%d", nameSize), 0, 0, 0, mode, nameSize+len(data))
+	buf.WriteString(name)
+	buf.Write(make([]byte, nameSize-len(name)))
+	offset := buf.Len()
+	buf.Write(data)
+	if (nameSize+len(data))%2 != 0 {
+		buf.WriteByte('\n')
+	}
+	return offset
+}
+
+// PackFiles writes object files into a static library. Members are named
+// after base names of the files. Empty format is the one returned by
+// DefaultArchiveFormat.
+func PackFiles(output string, files []string, format string) error {
+	members := []ArchiveMember{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		members = append(members, ArchiveMember{filepath.Base(file), data})
+	}
+	if format == "" {
+		format = DefaultArchiveFormat(members)
+	}
+	data, err := WriteArchive(members, format)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output, data, 0644)
+}
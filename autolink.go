@@ -0,0 +1,256 @@
+package catlib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// section type of '.deplibs', which lists libraries from
+	// '#pragma comment(lib, ...)'.
+	elfSHT_LLVM_DEPENDENT_LIBRARIES = 0x6fff4c04
+	machoLC_LINKER_OPTION           = 0x2d
+)
+
+// autolinkLibraryMerged returns true when the library named in autolink
+// information, such as 'z' of '-lz' or 'zlib.lib', is one of inputLibNames.
+func autolinkLibraryMerged(name string, inputLibNames []string) bool {
+	n := DefaultLibName(name)
+	return contains(inputLibNames, n) || contains(inputLibNames, "lib"+n)
+}
+
+func isELF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("\x7fELF"))
+}
+
+// removeAutolinkLibraries removes libraries in inputLibNames from autolink
+// information of an ELF ('.deplibs' section) or Mach-O (LC_LINKER_OPTION)
+// object, and returns names of the kept ones. All of them are removed when
+// inputLibNames is empty.
+func removeAutolinkLibraries(filePath string, inputLibNames []string) ([]string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return []string{}, err
+	}
+
+	var ret []byte
+	kept := []string{}
+	switch {
+	case isELF(data):
+		ret, kept, err = removeELFDependentLibraries(data, inputLibNames)
+	case isMachO(data):
+		ret, kept, err = removeMachOLinkerOptions(data, inputLibNames)
+	}
+	if err != nil {
+		return []string{}, fmt.Errorf("%s: %v", filePath, err)
+	}
+	if ret == nil {
+		return kept, nil
+	}
+	return kept, ioutil.WriteFile(filePath, ret, 0644)
+}
+
+// removeELFDependentLibraries removes entries of '.deplibs' sections. The
+// sections are rewritten in place and shrunk. It returns nil data when
+// nothing is removed.
+func removeELFDependentLibraries(data []byte, inputLibNames []string) ([]byte, []string, error) {
+	h, err := readELFHeader(data)
+	if err != nil {
+		return nil, []string{}, err
+	}
+
+	ret := append([]byte{}, data...)
+	kept := []string{}
+	changed := false
+	for i := 0; i < h.shnum; i++ {
+		sh := h.section(ret, i)
+		if h.order.Uint32(sh[4:]) != elfSHT_LLVM_DEPENDENT_LIBRARIES {
+			continue
+		}
+		offset, size := h.sectionRange(sh)
+		if offset+size > len(ret) {
+			return nil, []string{}, fmt.Errorf("'.deplibs' section out of range")
+		}
+
+		contents := []byte{}
+		for _, name := range strings.Split(string(ret[offset:offset+size]), "\x00") {
+			if name == "" {
+				continue
+			}
+			if len(inputLibNames) > 0 && !autolinkLibraryMerged(name, inputLibNames) {
+				kept = append(kept, DefaultLibName(name))
+				contents = append(append(contents, name...), 0)
+			}
+		}
+		if len(contents) == size {
+			continue
+		}
+		copy(ret[offset:offset+size], make([]byte, size))
+		copy(ret[offset:], contents)
+		h.setSectionRange(sh, offset, len(contents))
+		changed = true
+	}
+	if !changed {
+		return nil, kept, nil
+	}
+	return ret, kept, nil
+}
+
+// removeMachOLinkerOptions removes LC_LINKER_OPTION load commands such as
+// '-lz' or '-framework Foo'. Following load commands are moved forward, so
+// offsets of the other contents stay the same. It returns nil data when
+// nothing is removed.
+func removeMachOLinkerOptions(data []byte, inputLibNames []string) ([]byte, []string, error) {
+	h, err := readMachOHeader(data)
+	if err != nil {
+		return nil, []string{}, err
+	}
+	order := h.order
+
+	kept := []string{}
+	commands := []byte{}
+	ncmds := 0
+	offset := h.headerSize
+	for i := 0; i < h.ncmds; i++ {
+		if offset+8 > h.headerSize+h.sizeofcmds {
+			return nil, []string{}, fmt.Errorf("load command out of range")
+		}
+		cmd := order.Uint32(data[offset:])
+		cmdsize := int(order.Uint32(data[offset+4:]))
+		if cmdsize < 8 || offset+cmdsize > h.headerSize+h.sizeofcmds {
+			return nil, []string{}, fmt.Errorf("invalid load command size %d", cmdsize)
+		}
+		command := data[offset : offset+cmdsize]
+		offset += cmdsize
+
+		if cmd == machoLC_LINKER_OPTION && cmdsize >= 12 {
+			options := linkerOptionStrings(command[12:], int(order.Uint32(command[8:])))
+			name := autolinkName(options)
+			if name != "" && (len(inputLibNames) == 0 || autolinkLibraryMerged(name, inputLibNames)) {
+				continue
+			}
+			if name != "" {
+				kept = append(kept, DefaultLibName(name))
+			}
+		}
+		commands = append(commands, command...)
+		ncmds++
+	}
+	if ncmds == h.ncmds {
+		return nil, kept, nil
+	}
+
+	ret := append([]byte{}, data...)
+	copy(ret[h.headerSize:h.headerSize+h.sizeofcmds], make([]byte, h.sizeofcmds))
+	copy(ret[h.headerSize:], commands)
+	order.PutUint32(ret[16:], uint32(ncmds))
+	order.PutUint32(ret[20:], uint32(len(commands)))
+	return ret, kept, nil
+}
+
+func linkerOptionStrings(data []byte, count int) []string {
+	ret := []string{}
+	for len(ret) < count && len(data) > 0 {
+		i := bytes.IndexByte(data, 0)
+		if i < 0 {
+			i = len(data)
+		}
+		ret = append(ret, string(data[:i]))
+		if i == len(data) {
+			break
+		}
+		data = data[i+1:]
+	}
+	return ret
+}
+
+// autolinkName returns library name of linker options, such as 'z' of
+// ['-lz'] or 'Foo' of ['-framework', 'Foo']. It returns empty string for
+// other options.
+func autolinkName(options []string) string {
+	if len(options) == 1 && strings.HasPrefix(options[0], "-l") {
+		return strings.TrimPrefix(options[0], "-l")
+	}
+	if len(options) == 2 && (options[0] == "-framework" || options[0] == "-weak_framework") {
+		return options[1]
+	}
+	return ""
+}
+
+// ReadLibDeps reads arguments in '__.LIBDEP' member of a static library,
+// recorded by GNU ar's '--record-libdeps'. It returns nil when the library
+// has no such member.
+func ReadLibDeps(filePath string) ([]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(f, magic); err != nil || string(magic) != "!<arch>\n" {
+		return nil, nil
+	}
+	header := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(f, header); err != nil {
+			return nil, nil
+		}
+		start, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimRight(string(header[0:16]), " ")
+		size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid member size", filePath)
+		}
+		next := start + int64(size+size%2)
+
+		// BSD style long name follows the header.
+		if strings.HasPrefix(name, "#1/") {
+			n, _ := strconv.Atoi(name[3:])
+			longName := make([]byte, n)
+			if _, err := io.ReadFull(f, longName); err != nil {
+				return nil, err
+			}
+			name = string(bytes.TrimRight(longName, "\x00"))
+			size -= n
+		}
+		if name == "__.LIBDEP" || name == "__.LIBDEP/" {
+			contents := make([]byte, size)
+			if _, err := io.ReadFull(f, contents); err != nil {
+				return nil, err
+			}
+			return strings.Fields(string(bytes.TrimRight(contents, "\x00"))), nil
+		}
+		if _, err := f.Seek(next, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// KeptLibDeps returns names of libraries recorded in '__.LIBDEP' member of
+// a static library (see ReadLibDeps), which are not in inputLibNames.
+func KeptLibDeps(filePath string, inputLibNames []string) ([]string, error) {
+	args, err := ReadLibDeps(filePath)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-l") {
+			continue
+		}
+		name := strings.TrimPrefix(arg, "-l")
+		if !autolinkLibraryMerged(name, inputLibNames) {
+			ret = append(ret, DefaultLibName(name))
+		}
+	}
+	return ret, nil
+}
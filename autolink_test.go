@@ -0,0 +1,52 @@
+package catlib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testdata/deplibs.o has '.deplibs' of 'z', 'foo' and 'm', and
+// testdata/linker_option.o has '-lz', '-framework Foo' and '-lc++'.
+// names in inputLibNames are lower cased by DefaultLibName.
+func TestRemoveAutolinkLibraries(t *testing.T) {
+	tests := []struct {
+		file          string
+		inputLibNames []string
+		kept          []string
+	}{
+		{"deplibs.o", []string{"libfoo"}, []string{"z", "m"}},
+		{"deplibs.o", []string{"z", "m", "foo"}, []string{}},
+		{"deplibs.o", []string{}, []string{}},
+		{"linker_option.o", []string{"foo"}, []string{"z", "c++"}},
+		{"linker_option.o", []string{"libz", "foo", "c++"}, []string{}},
+		{"linker_option.o", []string{}, []string{}},
+	}
+	for _, test := range tests {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		filePath := filepath.Join(t.TempDir(), test.file)
+		if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		kept, err := removeAutolinkLibraries(filePath, test.inputLibNames)
+		if err != nil {
+			t.Fatalf("%s %q: %v", test.file, test.inputLibNames, err)
+		}
+		if !reflect.DeepEqual(kept, test.kept) {
+			t.Errorf("%s %q: kept %q, want %q", test.file, test.inputLibNames, kept, test.kept)
+		}
+		// the rewritten object has only the kept ones.
+		again, err := removeAutolinkLibraries(filePath, []string{"nosuch"})
+		if err != nil {
+			t.Fatalf("%s %q: %v", test.file, test.inputLibNames, err)
+		}
+		if !reflect.DeepEqual(again, test.kept) {
+			t.Errorf("%s %q: rewritten object has %q, want %q", test.file, test.inputLibNames, again, test.kept)
+		}
+	}
+}
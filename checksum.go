@@ -0,0 +1,56 @@
+package catlib
+
+import (
+	"fmt"
+)
+
+// coffChecksumSectionName is the name of the section with checksums of
+// the other sections of MSVC objects, 8 bytes for each section. Its
+// algorithm is undocumented, so catlib removes the section from objects it
+// modifies, instead of recomputing it. Linkers do not require it.
+const coffChecksumSectionName = ".chks64"
+
+// RemoveChecksumSection removes '.chks64' section, and returns true when
+// the object had one.
+func (this *COFFObject) RemoveChecksumSection() (bool, error) {
+	section := this.Section(coffChecksumSectionName)
+	if section == nil {
+		return false, nil
+	}
+	return true, this.RemoveSection(section)
+}
+
+// VerifyChecksums verifies checksums in section definition records, which
+// are JamCRC of section contents, and returns descriptions of mismatches.
+// Only the size of '.chks64' section is verified, because its algorithm is
+// undocumented.
+func (this *COFFObject) VerifyChecksums() []string {
+	ret := []string{}
+	for _, sym := range this.Symbols {
+		if !sym.IsSectionDefinition() || sym.Section.Data == nil {
+			continue
+		}
+		checksum := coffAuxChecksum(sym.Aux[0])
+		if checksum == 0 {
+			continue
+		}
+		if expected := jamCRC(sym.Section.Data); checksum != expected {
+			ret = append(ret, fmt.Sprintf("section '%s' (#%d) has checksum 0x%08x, but its contents have 0x%08x", sym.Section.Name, this.sectionNumber(sym.Section), checksum, expected))
+		}
+	}
+	if section := this.Section(coffChecksumSectionName); section != nil && section.Data != nil {
+		if len(section.Data) != 8*len(this.Sections) {
+			ret = append(ret, fmt.Sprintf("section '%s' has %d bytes, but %d bytes expected for %d sections", coffChecksumSectionName, len(section.Data), 8*len(this.Sections), len(this.Sections)))
+		}
+	}
+	return ret
+}
+
+func (this *COFFObject) sectionNumber(section *COFFSection) int {
+	for i, s := range this.Sections {
+		if s == section {
+			return i + 1
+		}
+	}
+	return 0
+}
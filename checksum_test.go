@@ -0,0 +1,104 @@
+package catlib
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestJamCRC(t *testing.T) {
+	tests := []struct {
+		data string
+		want uint32
+	}{
+		{"", 0xffffffff},
+		{"123456789", 0x340bc6d9},
+	}
+	for _, test := range tests {
+		if got := jamCRC([]byte(test.data)); got != test.want {
+			t.Errorf("%q: 0x%08x, want 0x%08x", test.data, got, test.want)
+		}
+	}
+}
+
+// checksumTestObject returns an object with '.text' section, whose section
+// definition record has a checksum.
+func checksumTestObject(t *testing.T) *COFFObject {
+	obj := &COFFObject{Machine: 0x8664}
+	text := &COFFSection{Name: ".text", Data: []byte{0x90, 0x90, 0xc3}, Characteristics: 0x60501020}
+	obj.Sections = append(obj.Sections, text)
+	aux := make([]byte, 18)
+	binary.LittleEndian.PutUint32(aux[8:12], 1)
+	obj.Symbols = append(obj.Symbols, &COFFSymbol{Name: ".text", Section: text, StorageClass: IMAGE_SYM_CLASS_STATIC, Aux: [][]byte{aux}})
+	data, err := obj.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, err := ReadCOFFObject(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func rereadCOFFObject(t *testing.T, obj *COFFObject) *COFFObject {
+	data, err := obj.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, err := ReadCOFFObject(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+// checksums of modified sections are recomputed when they are written.
+func TestAuxChecksum(t *testing.T) {
+	obj := checksumTestObject(t)
+	if got, want := coffAuxChecksum(obj.Symbols[0].Aux[0]), jamCRC([]byte{0x90, 0x90, 0xc3}); got != want {
+		t.Errorf("checksum 0x%08x, want 0x%08x", got, want)
+	}
+	if problems := obj.VerifyChecksums(); len(problems) > 0 {
+		t.Errorf("%q", problems)
+	}
+
+	obj.Sections[0].Data = []byte{0xc3}
+	obj = rereadCOFFObject(t, obj)
+	if got, want := coffAuxChecksum(obj.Symbols[0].Aux[0]), jamCRC([]byte{0xc3}); got != want {
+		t.Errorf("checksum of modified section 0x%08x, want 0x%08x", got, want)
+	}
+	if problems := obj.VerifyChecksums(); len(problems) > 0 {
+		t.Errorf("%q", problems)
+	}
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	// contents are not modified, so the wrong checksum is kept.
+	obj := checksumTestObject(t)
+	binary.LittleEndian.PutUint32(obj.Symbols[0].Aux[0][8:12], 0x12345678)
+	obj = rereadCOFFObject(t, obj)
+	problems := obj.VerifyChecksums()
+	if !hasProblem(problems, "section '.text' (#1) has checksum 0x12345678, but its contents have 0x") {
+		t.Errorf("%q", problems)
+	}
+
+	// zero means no checksum.
+	binary.LittleEndian.PutUint32(obj.Symbols[0].Aux[0][8:12], 0)
+	obj = rereadCOFFObject(t, obj)
+	if problems := obj.VerifyChecksums(); len(problems) > 0 {
+		t.Errorf("%q", problems)
+	}
+
+	// only the size of '.chks64' is verified.
+	obj.Sections = append(obj.Sections, &COFFSection{Name: coffChecksumSectionName, Data: make([]byte, 16), Characteristics: 0x00000a00})
+	if problems := obj.VerifyChecksums(); len(problems) > 0 {
+		t.Errorf("%q", problems)
+	}
+	obj.Sections[1].Data = make([]byte, 8)
+	if problems := obj.VerifyChecksums(); !hasProblem(problems, "section '.chks64' has 8 bytes, but 16 bytes expected for 2 sections") {
+		t.Errorf("%q", problems)
+	}
+	if removed, err := obj.RemoveChecksumSection(); !removed || err != nil || obj.Section(coffChecksumSectionName) != nil {
+		t.Errorf("'.chks64' is not removed: %v", err)
+	}
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	. "github.com/kbinani/catlib"
 	"github.com/ogier/pflag"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -28,285 +31,604 @@ func init() {
 	runtime.GOMAXPROCS(cpus)
 }
 
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+var commands = []command{
+	{"merge", "concatenate base libraries and members of input libraries they need (default)", merge},
+	{"ls", "list members of libraries", ls},
+	{"nm", "list symbols of members", nm},
+	{"extract", "extract members of a library", extract},
+	{"pack", "create a static library from object files", pack},
+	{"info", "print format, architecture, and member and symbol counts of libraries", info},
+	{"diff", "compare members, symbols, directives and architectures of two libraries", diff},
+	{"verify", "check symbol tables, member headers and objects of libraries", verify},
+}
+
 func main() {
-	start := time.Now()
+	exitCode := 0
 	defer func() {
 		os.RemoveAll(TempDir())
-		elapsed := time.Since(start)
-		fmt.Fprintf(os.Stderr, "Elapsed %s\n", elapsed)
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
 	}()
 
-	input := pflag.String("input", "", "comma separated list of file path of import libs")
-	base := pflag.String("base", "", "file path of base static library")
-	output := pflag.String("output", "", "file path of output library")
-	arch := pflag.String("arch", "x86_64", "x86_64 or i386 (macOS only)")
-	deleteDefaultLib := pflag.Bool("delete-default-lib", true, "delete '-defaultlib:\"libfoo\"' from '.drectve' section when libfoo.lib is in '--input' (Windows only)")
-	libflags := pflag.String("extra-lib-flags", "", "extra 'lib' command options for final concatenation stage")
-	pflag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", filepath.Base(os.Args[0]))
-		pflag.PrintDefaults()
+	// flags without a command are of 'merge', for compatibility.
+	args := os.Args[1:]
+	name := "merge"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name = args[0]
+		args = args[1:]
+	}
+	for _, c := range commands {
+		if c.name == name {
+			exitCode = c.run(args)
+			return
+		}
+	}
+	if name != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n", name)
+		exitCode = 2
+	}
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [options]\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(os.Stderr, "Run '%s <command> --help' for options of the command.\n", filepath.Base(os.Args[0]))
+}
+
+// merge concatenates base libraries and members of input libraries needed to
+// resolve their symbols.
+func merge(args []string) (exitCode int) {
+	start := time.Now()
+	flags := pflag.NewFlagSet("merge", pflag.ExitOnError)
+
+	input := flags.String("input", "", "comma separated list of file path of import libs. append ':whole' to include all members of the lib")
+	var bases stringList
+	flags.Var(&bases, "base", "file path of base static library or object file. repeat, or separate with comma to specify more than one")
+	output := flags.String("output", "", "file path of output library")
+	arch := flags.String("arch", "x86_64", "x86_64 or i386 (macOS only)")
+	deleteDefaultLib := flags.Bool("delete-default-lib", true, "delete '-defaultlib:\"libfoo\"' from '.drectve' section (LC_LINKER_OPTION '-lfoo' of Mach-O, '.deplibs' section of ELF) when libfoo is in '--input'")
+	defaultLibMap := flags.String("defaultlib-map", "", "comma separated list of 'old=new', which replaces '-defaultlib:\"old\"' in '.drectve' section with '-defaultlib:\"new\"' (Windows only)")
+	defaultLibMapFile := flags.String("defaultlib-map-file", "", "file path of '-defaultlib' rename map, each line is 'old new' (Windows only)")
+	stripExports := flags.Bool("strip-exports", false, "remove '/EXPORT' directives from '.drectve' section of members pulled from '--input' (Windows only)")
+	verifySectionCRCs := flags.Bool("verify-section-crcs", false, "verify JamCRC checksums of section contents, which are recorded in section symbols of COFF members, before modifying them, and fail on mismatch. '.chks64' section is checked only for its size, because its algorithm is undocumented, and is removed from modified members (Windows only)")
+	stripBaseExports := flags.Bool("strip-base-exports", false, "remove '/EXPORT' directives from '.drectve' section of members of '--base' (Windows only)")
+	libflags := flags.String("extra-lib-flags", "", "extra 'lib' command options for final concatenation stage")
+	redefineSyms := flags.String("redefine-syms", "", "file path of symbol rename map, each line is 'old new'. applied to members pulled from '--input', and references to them from '--base'")
+	unresolvedReport := flags.String("unresolved-report", "", "file path to write symbols left undefined, grouped by members referencing them. '-' for stdout")
+	unresolvedReportJSON := flags.String("unresolved-report-json", "", "file path to write symbols left undefined in JSON format. '-' for stdout")
+	failOnUnresolved := flags.Bool("fail-on-unresolved", false, "fail when symbols not provided by runtime or OS libraries are left undefined, unless listed in '--unresolved-allowlist'. symbols expected from kept '-defaultlib' libraries are not known to be defined there, so they fail too")
+	unresolvedAllowlist := flags.String("unresolved-allowlist", "", "file path of symbol list allowed to be left undefined, one symbol per line. 'prefix*' matches by prefix")
+	why := flags.String("why", "", "print the shortest reference chain from base members to a symbol or a member ('lib:member'), instead of creating output")
+	prefixSymbols := flags.String("prefix-symbols", "", "prefix prepended to the names of symbols defined by members pulled from '--input', and references to them")
+	localizeInputSymbols := flags.Bool("localize-input-symbols", false, "prelink members pulled from '--input' into single object, and make their symbols local except ones referenced from '--base' or listed in '--keep-global-symbols' (macOS only)")
+	includeInitializers := flags.Bool("include-initializers", false, "include members of '--input' which have static initializers (or TLS callbacks) but no exported symbols. members of '--base' are always included")
+	objc := flags.Bool("objc", false, "include members of '--input' which define Objective-C classes or categories, same as ld64's '-ObjC' (macOS only)")
+	semantics := flags.String("semantics", "", "linker search semantics, one of 'msvc', 'ld64', 'gnu' or 'gnu-group'. 'gnu' never searches inputs already passed, even for targets of '/ALTERNATENAME'. default is the one of host linker")
+	manifest := flags.String("manifest", "", "file path to write JSON manifest of members included in the output")
+	graph := flags.String("graph", "", "file path to write member dependency graph in DOT format")
+	graphJSON := flags.String("graph-json", "", "file path to write member dependency graph in JSON format")
+	roots := flags.String("roots", "", "file path of symbols the output has to provide: a symbol list, a Mach-O exported symbols list or a module-definition (.def) file. base members unreachable from them are dropped")
+	format := addFormatFlag(flags)
+	keepGlobalSymbols := flags.String("keep-global-symbols", "", "file path of symbol list kept global by '--localize-input-symbols', one symbol per line")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s merge:\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
 
 		lines := []string{
 			"Example:",
-			"  catlib --base=myproject.lib ^",
-			"         --input=zlibstat.lib,libprotobuf.lib ^",
-			"         --output=myproject-prelinked.lib ^",
-			"         --delete-default-lib ^",
-			"         --extra-lib-flags=\"/LTCG /WX\"",
+			"  catlib merge --base=myproject.lib ^",
+			"               --input=zlibstat.lib,libprotobuf.lib ^",
+			"               --output=myproject-prelinked.lib ^",
+			"               --delete-default-lib ^",
+			"               --extra-lib-flags=\"/LTCG /WX\"",
 		}
 		for _, line := range lines {
 			fmt.Fprintf(os.Stderr, "%s\n", line)
 		}
 	}
 
-	pflag.Parse()
+	flags.Parse(args)
+	if !validFormat(*format) {
+		return 2
+	}
+
+	out := newMergeOutput(*format)
+	defer func() {
+		// panics are recorded in the report, and raised again.
+		var recovered interface{}
+		if out.json {
+			recovered = recover()
+		}
+		elapsed := time.Since(start)
+		out.finish(elapsed, recovered)
+		fmt.Fprintf(os.Stderr, "Elapsed %s\n", elapsed)
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
 
-	if runtime.GOOS != "windows" {
-		*deleteDefaultLib = false
+	if out.json {
+		// stdout has nothing but the report.
+		for _, name := range []string{"manifest", "graph", "graph-json", "unresolved-report", "unresolved-report-json"} {
+			if flags.Lookup(name).Value.String() == "-" {
+				return out.abort(os.Stderr, fmt.Sprintf("'--%s=-' is not allowed with '--format=json'", name), nil)
+			}
+		}
+	}
+	if runtime.GOOS == "windows" && *localizeInputSymbols {
+		return out.abort(os.Stderr, "'--localize-input-symbols' is not supported on Windows", nil)
 	}
 
-	inputFiles := strings.Split(*input, ",")
-	baseFile, _ := filepath.Abs(*base)
+	inputFiles := []string{}
+	wholeArchiveInputs := []string{}
+	for _, inputFile := range strings.Split(*input, ",") {
+		if strings.HasSuffix(inputFile, ":whole") {
+			inputFile = strings.TrimSuffix(inputFile, ":whole")
+			wholeArchiveInputs = append(wholeArchiveInputs, inputFile)
+		}
+		inputFiles = append(inputFiles, inputFile)
+	}
+	baseFiles := []string{}
+	for _, base := range bases {
+		baseFile, _ := filepath.Abs(base)
+		baseFiles = append(baseFiles, baseFile)
+	}
 	outputFile, _ := filepath.Abs(*output)
 
+	var err error
 	inputLibNames := []string{}
 	for _, inputFile := range inputFiles {
-		name := strings.ToLower(filepath.Base(inputFile))
-		ext := filepath.Ext(name)
-		if ext != "" {
-			name = strings.TrimSuffix(name, ext)
+		inputLibNames = append(inputLibNames, DefaultLibName(inputFile))
+	}
+
+	defaultLibNames := make(map[string]string)
+	if *defaultLibMapFile != "" {
+		names, err := ReadSymbolMapFile(*defaultLibMapFile)
+		if err != nil {
+			return out.fail(err)
+		}
+		for old, n := range names {
+			defaultLibNames[DefaultLibName(old)] = n
 		}
-		inputLibNames = append(inputLibNames, name)
+	}
+	for _, entry := range strings.Split(*defaultLibMap, ",") {
+		if entry == "" {
+			continue
+		}
+		i := strings.Index(entry, "=")
+		if i < 0 {
+			return out.abort(os.Stderr, fmt.Sprintf("'--defaultlib-map' entry should be 'old=new' but got '%s'", entry), nil)
+		}
+		defaultLibNames[DefaultLibName(entry[:i])] = entry[i+1:]
 	}
 
-	keptLibNames := NewStringSet()
+	redefinedSymbols := make(map[string]string)
+	if *redefineSyms != "" {
+		redefinedSymbols, err = ReadSymbolMapFile(*redefineSyms)
+		if err != nil {
+			return out.fail(err)
+		}
+	}
 
-	importSyms := NewStringSet()
+	keptGlobalSymbols := []string{}
+	if *keepGlobalSymbols != "" {
+		keptGlobalSymbols, err = ReadSymbolListFile(*keepGlobalSymbols)
+		if err != nil {
+			return out.fail(err)
+		}
+	}
+
+	rootSymbols := []string{}
+	if *roots != "" {
+		rootSymbols, err = ReadRootSymbolsFile(*roots)
+		if err != nil {
+			return out.fail(err)
+		}
+		if len(rootSymbols) == 0 {
+			return out.abort(os.Stderr, "'--roots' has no symbol", nil)
+		}
+	}
+
+	allowedUnresolvedSymbols := []string{}
+	if *unresolvedAllowlist != "" {
+		allowedUnresolvedSymbols, err = ReadSymbolListFile(*unresolvedAllowlist)
+		if err != nil {
+			return out.fail(err)
+		}
+	}
+
+	keptLibNames := NewStringSet()
+	keptDefaultLibs := make(map[*PlanMember][]string)
+	removedExports := make(map[*PlanMember][]string)
+	checksumErrors := make(map[*PlanMember][]string)
 
 	work, _ := ioutil.TempDir(TempDir(), "objects")
 
 	lastResolvedName := ""
-	extracted := NewStringSet()
-	index := 0
-
-	// explode baseFile
-	baseLib := new(LibFile)
-	err := baseLib.Open(baseFile, *arch)
+	progress := func(depth, totalNumResolved int, symName string) {
+		name := fmt.Sprintf("%d:RESOLVED:%d:%s", depth, totalNumResolved, symName)
+		if len(name) < len(lastResolvedName) {
+			fmt.Printf("\r%s", strings.Repeat(" ", len(lastResolvedName)))
+		}
+		fmt.Printf("\r%s", name)
+		lastResolvedName = name
+	}
+	if out.json {
+		progress = nil
+	}
+	resolver := NewResolver(ResolverOptions{
+		Bases:               baseFiles,
+		Inputs:              inputFiles,
+		Roots:               rootSymbols,
+		WholeArchiveInputs:  wholeArchiveInputs,
+		IncludeInitializers: *includeInitializers,
+		ObjC:                *objc,
+		Semantics:           *semantics,
+		Arch:                *arch,
+		Progress:            progress,
+	})
+	defer resolver.Close()
+
+	ctx := context.Background()
+	phase := time.Now()
+	plan, err := resolver.Resolve(ctx)
+	if lastResolvedName != "" {
+		fmt.Printf("\n")
+	}
 	if err != nil {
-		panic(err)
+		return out.fail(err)
 	}
-	defer baseLib.Close()
+	out.report.Timing.Resolve = time.Since(phase).Seconds()
+	out.report.SetPlan(plan)
 
-	m := new(sync.Mutex)
-	var wg sync.WaitGroup
+	if *graph != "" {
+		if err := writeFile(*graph, plan.WriteGraphDot); err != nil {
+			return out.fail(err)
+		}
+	}
+	if *graphJSON != "" {
+		if err := writeFile(*graphJSON, plan.WriteGraphJSON); err != nil {
+			return out.fail(err)
+		}
+	}
 
-	for i := 0; i < baseLib.NumMembers(); i++ {
-		if len(baseLib.ExportSymbols(i)) == 0 && len(baseLib.ImportSymbols(i)) == 0 {
-			continue
+	if len(plan.DroppedInitializers) > 0 {
+		labels := []string{}
+		for _, member := range plan.DroppedInitializers {
+			labels = append(labels, member.Label())
 		}
-		name := fmt.Sprintf("b%d%s", index, objExt)
-		p := filepath.Join(work, name)
+		out.warn("These members of '--input' have static initializers but no exported symbols, and were dropped. Use '--include-initializers' to include them", labels)
+	}
 
-		wg.Add(1)
-		go func(i int, objectFile string) {
-			defer wg.Done()
+	if len(plan.DroppedBase) > 0 {
+		var size int64
+		labels := []string{}
+		for _, member := range plan.DroppedBase {
+			size += member.Size
+			labels = append(labels, fmt.Sprintf("%s:%s", filepath.Base(member.Library), member.Name))
+		}
+		out.list(os.Stderr, fmt.Sprintf("These %d base members are unreachable from '--roots', and were dropped (%d bytes)", len(plan.DroppedBase), size), labels)
+	}
+	if len(plan.UnmatchedRoots) > 0 {
+		out.warn("These symbols in '--roots' are not defined by base members", plan.UnmatchedRoots)
+	}
 
-			f, err := os.Create(objectFile)
-			if err != nil {
-				panic(err)
-			}
-			if err := baseLib.Extract(i, f); err != nil {
-				panic(err)
-			}
-			f.Close()
-
-			// replace .drectve section
-			if *deleteDefaultLib {
-				var obj ObjectFile
-				obj.Open(objectFile)
-				names, err := obj.RemoveDefaultlibDrectve(inputLibNames)
-				if err != nil {
-					panic(err)
-				}
-				if len(names) > 0 {
-					m.Lock()
-					for _, name := range names {
-						keptLibNames.Put(name)
-					}
-					m.Unlock()
-				}
+	if len(plan.Duplicates) > 0 {
+		items := []string{}
+		for _, dup := range plan.Duplicates {
+			labels := []string{}
+			for _, member := range dup.Members {
+				labels = append(labels, fmt.Sprintf("%s:%s", filepath.Base(member.Library), member.Name))
 			}
+			items = append(items, fmt.Sprintf("%s (%s)", dup.Name, strings.Join(labels, ", ")))
+		}
+		out.warn("These symbols are defined by more than one base member", items)
+	}
 
-			newname := fmt.Sprintf("%s%s", Sha256sum(objectFile), objExt)
-			newp := filepath.Join(work, newname)
-			for true {
-				if err := os.Rename(objectFile, newp); err != nil {
-					m.Lock()
-					fmt.Fprintf(os.Stderr, "Info: retry renaming %s\n", objectFile)
-					fmt.Fprintf(os.Stderr, "Reason:\n")
-					fmt.Fprintf(os.Stderr, "\t%v\n", err)
-					m.Unlock()
-					continue
-				}
-				break
+	if *why != "" {
+		chain, err := plan.Why(*why)
+		if err != nil {
+			return out.fail(err)
+		}
+		if out.json {
+			out.report.SetWhy(plan, *why, chain)
+		} else if len(chain) == 0 {
+			member := plan.FindMember(*why)
+			if member.IsBase() {
+				fmt.Printf("%s is a member of '--base'\n", member.Label())
+			} else {
+				fmt.Printf("%s is included by %s\n", member.Label(), member.Reason)
 			}
+		} else {
+			fmt.Printf("%s\n", FormatReferences(chain))
+		}
+		return
+	}
 
-			m.Lock()
-			extracted.Put(newname)
-			m.Unlock()
-		}(i, p)
-
-		index++
+	if len(plan.Pulled) == 0 {
+		return out.abort(os.Stdout, "No symbol resolved", nil)
+	}
 
-		for _, sym := range baseLib.ImportSymbols(i) {
-			importSyms.Put(sym.Name())
+	if conflicts := plan.FailIfMismatchConflicts(); len(conflicts) > 0 {
+		items := []string{}
+		for _, conflict := range conflicts {
+			items = append(items, conflict.Error())
 		}
+		return out.abort(os.Stderr, "Members have conflicting '/FAILIFMISMATCH' values", items)
 	}
 
-	wg.Wait()
+	pulledSymbols := NewStringSet()
+	for _, member := range plan.Pulled {
+		for _, sym := range member.Exports {
+			pulledSymbols.Put(sym)
+		}
+	}
 
-	libMap := openLibFiles(inputFiles, *arch)
-	defer func() {
-		for _, lib := range libMap {
-			lib.Close()
+	names := make(map[string]string)
+	for old, n := range redefinedSymbols {
+		names[old] = n
+	}
+	if *prefixSymbols != "" {
+		for _, sym := range pulledSymbols.Values() {
+			if _, ok := names[sym]; !ok {
+				names[sym] = *prefixSymbols + sym
+			}
 		}
-	}()
+	}
+	unappliedRenames := []string{}
+	for old, n := range redefinedSymbols {
+		if !pulledSymbols.Has(old) {
+			unappliedRenames = append(unappliedRenames, fmt.Sprintf("%s %s", old, n))
+		}
+	}
+	if len(unappliedRenames) > 0 {
+		sort.Strings(unappliedRenames)
+		out.warn("These '--redefine-syms' entries were not applied, because no member pulled from '--input' defines the symbols", unappliedRenames)
+	}
+	unrenamedMembers := make(map[*PlanMember]bool)
 
-	alreadyResolvedSymbols := NewStringSet()
-	alreadyExtractedFiles := NewStringSet()
+	m := new(sync.Mutex)
+	phase = time.Now()
+	members, err := resolver.Extract(ctx, plan, work, func(member *PlanMember, objectFile string) error {
+		var obj ObjectFile
+		obj.Open(objectFile)
 
-	totalNumResolved := 0
-	itr := 0
-	for true {
-		itr++
-		numResolved := 0
-		for k, inputFile := range inputFiles {
-			lib := libMap[inputFile]
+		if *verifySectionCRCs {
+			errors, err := obj.VerifyChecksums()
+			if err != nil {
+				return err
+			}
+			if len(errors) > 0 {
+				m.Lock()
+				checksumErrors[member] = errors
+				m.Unlock()
+			}
+		}
 
-			for i := 0; i < lib.NumMembers(); i++ {
-				name := fmt.Sprintf("%d_%d%s", k, i, objExt)
-				if alreadyExtractedFiles.Has(name) {
-					continue
-				}
+		if err := obj.MapDefaultLibs(defaultLibNames); err != nil {
+			return err
+		}
 
-				exportSymbols := lib.ExportSymbols(i)
-				if len(exportSymbols) == 0 {
-					alreadyExtractedFiles.Put(name)
-					continue
+		// replace .drectve section
+		if *deleteDefaultLib {
+			kept, err := obj.RemoveDefaultlibDrectve(inputLibNames)
+			if err != nil {
+				return err
+			}
+			if len(kept) > 0 {
+				m.Lock()
+				for _, name := range kept {
+					keptLibNames.Put(name)
 				}
+				keptDefaultLibs[member] = kept
+				m.Unlock()
+			}
+		}
 
-				resolved := 0
-				for _, sym := range exportSymbols {
-					symName := sym.Name()
-					if !importSyms.Has(symName) {
-						continue
-					}
-					resolved++
-					alreadyResolvedSymbols.Put(symName)
-					importSyms.Del(symName)
-
-					numResolved++
-					totalNumResolved++
-
-					name := fmt.Sprintf("%d:RESOLVED:%d:%s", itr, totalNumResolved, symName)
-					if len(name) < len(lastResolvedName) {
-						fmt.Printf("\r%s", strings.Repeat(" ", len(lastResolvedName)))
-					}
-					fmt.Printf("\r%s", name)
-					lastResolvedName = name
-				}
+		if (member.IsBase() && *stripBaseExports) || (!member.IsBase() && *stripExports) {
+			removed, err := obj.RemoveExportDirectives()
+			if err != nil {
+				return err
+			}
+			if len(removed) > 0 {
+				m.Lock()
+				removedExports[member] = removed
+				m.Unlock()
+			}
+		}
 
-				if resolved == 0 {
-					continue
+		renames := names
+		if member.IsBase() {
+			// base members: only references to the symbols defined by pulled members are renamed.
+			renames = make(map[string]string)
+			for _, sym := range member.Imports {
+				if n, ok := names[sym]; ok && pulledSymbols.Has(sym) {
+					renames[sym] = n
 				}
+			}
+		}
+		renamed, err := obj.RenameSymbols(renames)
+		if err != nil {
+			return err
+		}
+		if !renamed {
+			m.Lock()
+			unrenamedMembers[member] = true
+			m.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return out.fail(err)
+	}
+	out.report.Timing.Extract = time.Since(phase).Seconds()
+	if len(unrenamedMembers) > 0 {
+		labels := []string{}
+		for _, member := range plan.Members() {
+			if unrenamedMembers[member] {
+				labels = append(labels, member.Label())
+			}
+		}
+		out.warn("Symbols of these members are not readable, such as LLVM bitcode, and were not renamed", labels)
+	}
+	if len(checksumErrors) > 0 {
+		items := []string{}
+		for _, member := range plan.Members() {
+			for _, e := range checksumErrors[member] {
+				items = append(items, fmt.Sprintf("%s:%s: %s", filepath.Base(member.Library), member.Name, e))
+			}
+		}
+		return out.abort(os.Stderr, "These members have wrong section checksums", items)
+	}
 
-				alreadyExtractedFiles.Put(name)
-
-				p := filepath.Join(work, name)
-				f, err := os.Create(p)
-				if err != nil {
-					panic(err)
-				}
-				if err := lib.Extract(i, f); err != nil {
-					panic(err)
-				}
-				f.Close()
-
-				if *deleteDefaultLib {
-					var obj ObjectFile
-					obj.Open(p)
-					names, err := obj.RemoveDefaultlibDrectve(inputLibNames)
-					if err != nil {
-						panic(err)
-					}
-					for _, name := range names {
-						keptLibNames.Put(name)
-					}
-				}
-				newname := fmt.Sprintf("%s%s", Sha256sum(p), objExt)
-				newp := filepath.Join(work, newname)
-				if err := os.Rename(p, newp); err != nil {
-					panic(err)
-				}
+	unresolved := plan.UnresolvedReport(keptDefaultLibs)
+	out.report.Unresolved = unresolved.Members
+	if *unresolvedReport != "" {
+		if err := writeFile(*unresolvedReport, unresolved.WriteText); err != nil {
+			return out.fail(err)
+		}
+	}
+	if *unresolvedReportJSON != "" {
+		if err := writeFile(*unresolvedReportJSON, unresolved.WriteJSON); err != nil {
+			return out.fail(err)
+		}
+	}
+	if *failOnUnresolved {
+		if disallowed := unresolved.Disallowed(allowedUnresolvedSymbols); len(disallowed) > 0 {
+			return out.abort(os.Stderr, "These symbols are left undefined", disallowed)
+		}
+	}
 
-				extracted.Put(newname)
+	extracted := NewStringSet()
+	pulled := NewStringSet()
+	for _, member := range members {
+		extracted.Put(member.FileName)
+		if !member.IsBase() {
+			pulled.Put(member.FileName)
+		}
+	}
 
-				for _, sym := range lib.ImportSymbols(i) {
-					if alreadyResolvedSymbols.Has(sym.Name()) {
-						continue
-					}
-					importSyms.Put(sym.Name())
+	phase = time.Now()
+	if *localizeInputSymbols {
+		// symbols referenced from base members have to be kept global.
+		exported := NewStringSet()
+		for _, member := range plan.Base {
+			for _, sym := range member.Imports {
+				if !pulledSymbols.Has(sym) {
+					continue
 				}
+				if n, ok := names[sym]; ok {
+					sym = n
+				}
+				exported.Put(sym)
 			}
 		}
+		for _, sym := range keptGlobalSymbols {
+			exported.Put(sym)
+		}
 
-		if numResolved == 0 {
-			break
+		p := filepath.Join(work, fmt.Sprintf("prelinked%s", objExt))
+		if err := Prelink(pulled.SortedValues(), p, work, *arch, exported.SortedValues()); err != nil {
+			return out.fail(err)
+		}
+		newname := fmt.Sprintf("%s%s", Sha256sum(p), objExt)
+		if err := os.Rename(p, filepath.Join(work, newname)); err != nil {
+			return out.fail(err)
 		}
+		for _, name := range pulled.Values() {
+			extracted.Del(name)
+		}
+		extracted.Put(newname)
 	}
 
-	if totalNumResolved == 0 {
-		fmt.Printf("ABORT: No symbol resolved\n")
-		return
-	} else {
-		fmt.Printf("\n")
+	if err := Concat(extracted.Values(), outputFile, work, *arch, *libflags); err != nil {
+		return out.fail(err)
 	}
+	out.report.Timing.Concat = time.Since(phase).Seconds()
+	out.report.Output = outputFile
 
-	if err := Concat(extracted.Values(), outputFile, work, *arch, *libflags); err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		return
+	if *manifest != "" {
+		if err := writeFile(*manifest, plan.WriteManifest); err != nil {
+			return out.fail(err)
+		}
 	}
-	if *deleteDefaultLib && keptLibNames.Size() > 0 {
-		fmt.Printf("These '-defaultlib:\"NAME\"' were not removed from '.drectve' section:\n")
-		for _, name := range keptLibNames.Values() {
-			fmt.Printf("  %s\n", name)
+	if len(removedExports) > 0 {
+		items := []string{}
+		for _, member := range plan.Members() {
+			if len(removedExports[member]) == 0 {
+				continue
+			}
+			for _, name := range removedExports[member] {
+				items = append(items, fmt.Sprintf("%s:%s: %s", filepath.Base(member.Library), member.Name, name))
+			}
+			out.report.RemovedExports = append(out.report.RemovedExports, ReportMember{Library: member.Library, Member: member.Name, Size: member.Size, Exports: removedExports[member]})
 		}
+		out.list(os.Stdout, "These '/EXPORT' directives were removed", items)
 	}
-}
-
-func openLibFiles(files []string, arch string) map[string]*LibFile {
-	ret := make(map[string]*LibFile)
-	var wg sync.WaitGroup
-	m := new(sync.Mutex)
-
-	for _, file := range files {
-		wg.Add(1)
-		go func(file, arch string) {
-			defer wg.Done()
-
-			lib := new(LibFile)
-			err := lib.Open(file, arch)
+	if *deleteDefaultLib {
+		// '__.LIBDEP' members are not copied to the output.
+		for _, file := range append(append([]string{}, baseFiles...), inputFiles...) {
+			kept, err := KeptLibDeps(file, inputLibNames)
 			if err != nil {
-				panic(err)
+				return out.fail(err)
+			}
+			for _, name := range kept {
+				keptLibNames.Put(name)
 			}
+		}
+	}
+	out.report.KeptDefaultLibs = keptLibNames.SortedValues()
+	if *deleteDefaultLib && keptLibNames.Size() > 0 {
+		out.list(os.Stdout, "These '-defaultlib:\"NAME\"' were not removed from '.drectve' section", keptLibNames.SortedValues())
+	}
 
-			m.Lock()
-			ret[file] = lib
-			m.Unlock()
-		}(file, arch)
+	phase = time.Now()
+	problems, err := VerifyArchive(outputFile)
+	if err != nil {
+		return out.fail(err)
+	}
+	out.report.Timing.Verify = time.Since(phase).Seconds()
+	if len(problems) > 0 {
+		exitCode = out.abort(os.Stderr, fmt.Sprintf("'%s' is broken", outputFile), problems)
 	}
+	return
+}
 
-	wg.Wait()
+func writeFile(filePath string, write func(w io.Writer) error) error {
+	if filePath == "-" {
+		return write(os.Stdout)
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-	return ret
+// stringList is a flag value which can be specified more than once, each
+// of which may be a comma separated list.
+type stringList []string
+
+func (this *stringList) String() string {
+	return strings.Join(*this, ",")
+}
+
+func (this *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v != "" {
+			*this = append(*this, v)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/kbinani/catlib"
+	"github.com/ogier/pflag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func setUsage(flags *pflag.FlagSet, usage string) {
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n", filepath.Base(os.Args[0]), usage)
+		flags.PrintDefaults()
+	}
+}
+
+// openArchive opens a static library or an object file.
+func openArchive(filePath string, arch string) (*Archive, error) {
+	a := new(Archive)
+	archive, err := IsArchiveFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if archive {
+		err = a.Open(filePath, arch)
+	} else {
+		err = a.OpenObject(filePath, arch)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// inspectedFile is an input file of 'ls' and 'nm' with '--format=json'.
+type inspectedFile struct {
+	File    string            `json:"file"`
+	Members []inspectedMember `json:"members"`
+	Error   string            `json:"error,omitempty"`
+}
+
+type inspectedMember struct {
+	Name    string            `json:"name"`
+	Size    int64             `json:"size"`
+	Format  string            `json:"format"`
+	Arch    string            `json:"arch"`
+	Symbols []inspectedSymbol `json:"symbols,omitempty"`
+}
+
+type inspectedSymbol struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Defined bool   `json:"defined"`
+	Weak    bool   `json:"weak"`
+}
+
+func newInspectedMember(a *Archive, i int) inspectedMember {
+	return inspectedMember{Name: a.MemberName(i), Size: a.MemberSize(i), Format: a.ObjectFormat(i), Arch: a.Arch(i)}
+}
+
+func ls(args []string) int {
+	flags := pflag.NewFlagSet("ls", pflag.ExitOnError)
+	arch := flags.String("arch", "", "architecture of universal binaries")
+	format := addFormatFlag(flags)
+	long := flags.Bool("long", false, "print size, object format and architecture of members")
+	setUsage(flags, "ls [options] <library>...")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if !validFormat(*format) {
+		return 2
+	}
+
+	exitCode := 0
+	files := []inspectedFile{}
+	for i, file := range flags.Args() {
+		a, err := openArchive(file, *arch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			files = append(files, inspectedFile{File: file, Members: []inspectedMember{}, Error: err.Error()})
+			exitCode = 1
+			continue
+		}
+		if *format == outputFormatJSON {
+			f := inspectedFile{File: file, Members: []inspectedMember{}}
+			for j := 0; j < a.NumMembers(); j++ {
+				f.Members = append(f.Members, newInspectedMember(a, j))
+			}
+			files = append(files, f)
+			a.Close()
+			continue
+		}
+		if flags.NArg() > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s:\n", file)
+		}
+		for j := 0; j < a.NumMembers(); j++ {
+			if *long {
+				fmt.Printf("%10d %-11s %-7s %s\n", a.MemberSize(j), orDash(a.ObjectFormat(j)), orDash(a.Arch(j)), a.MemberName(j))
+			} else {
+				fmt.Println(a.MemberName(j))
+			}
+		}
+		a.Close()
+	}
+	if *format == outputFormatJSON {
+		if err := writeJSON(map[string]interface{}{"files": files}); err != nil {
+			panic(err)
+		}
+	}
+	return exitCode
+}
+
+func nm(args []string) int {
+	flags := pflag.NewFlagSet("nm", pflag.ExitOnError)
+	arch := flags.String("arch", "", "architecture of universal binaries")
+	definedOnly := flags.Bool("defined-only", false, "print defined symbols only")
+	undefinedOnly := flags.Bool("undefined-only", false, "print undefined symbols only")
+	format := addFormatFlag(flags)
+	setUsage(flags, "nm [options] <library or object>...")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if !validFormat(*format) {
+		return 2
+	}
+	asJSON := *format == outputFormatJSON
+
+	exitCode := 0
+	files := []inspectedFile{}
+	for _, file := range flags.Args() {
+		a, err := openArchive(file, *arch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			files = append(files, inspectedFile{File: file, Members: []inspectedMember{}, Error: err.Error()})
+			exitCode = 1
+			continue
+		}
+		f := inspectedFile{File: file, Members: []inspectedMember{}}
+		for i := 0; i < a.NumMembers(); i++ {
+			if !asJSON {
+				if a.Format() != ArchiveFormatObject {
+					fmt.Printf("\n%s(%s):\n", file, a.MemberName(i))
+				} else if flags.NArg() > 1 {
+					fmt.Printf("\n%s:\n", file)
+				}
+			}
+			member := newInspectedMember(a, i)
+			member.Symbols = []inspectedSymbol{}
+			symbols := a.Symbols(i)
+			for j := range symbols {
+				sym := &symbols[j]
+				if (*definedOnly && !sym.IsExportSymbol()) || (*undefinedOnly && sym.IsExportSymbol()) {
+					continue
+				}
+				if asJSON {
+					member.Symbols = append(member.Symbols, inspectedSymbol{sym.Name(), string(sym.Kind()), sym.IsExportSymbol(), sym.IsWeak()})
+				} else {
+					fmt.Printf("%c %s\n", sym.Kind(), sym.Name())
+				}
+			}
+			f.Members = append(f.Members, member)
+		}
+		files = append(files, f)
+		a.Close()
+	}
+	if asJSON {
+		if err := writeJSON(map[string]interface{}{"files": files}); err != nil {
+			panic(err)
+		}
+	}
+	return exitCode
+}
+
+func extract(args []string) int {
+	flags := pflag.NewFlagSet("extract", pflag.ExitOnError)
+	arch := flags.String("arch", "", "architecture of universal binaries")
+	format := addFormatFlag(flags)
+	outputDir := flags.String("output-dir", ".", "directory to write members")
+	setUsage(flags, "extract [options] <library> [member...]")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if !validFormat(*format) {
+		return 2
+	}
+
+	file := flags.Arg(0)
+	a, err := openArchive(file, *arch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+		return 1
+	}
+	defer a.Close()
+
+	// members are selected by their name, or their base name.
+	selected := NewStringSet()
+	for _, name := range flags.Args()[1:] {
+		selected.Put(name)
+	}
+	found := NewStringSet()
+	written := NewStringSet()
+	extracted := []map[string]string{}
+	for i := 0; i < a.NumMembers(); i++ {
+		name := a.MemberName(i)
+		base := memberBaseName(name)
+		if selected.Size() > 0 {
+			if selected.Has(name) {
+				found.Put(name)
+			} else if selected.Has(base) {
+				found.Put(base)
+			} else {
+				continue
+			}
+		}
+
+		// members of the same name are written as 'name_1.obj', ...
+		fileName := base
+		for n := 1; written.Has(fileName); n++ {
+			ext := filepath.Ext(base)
+			fileName = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(base, ext), n, ext)
+		}
+		written.Put(fileName)
+
+		path := filepath.Join(*outputDir, fileName)
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		err = a.Extract(i, f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return 1
+		}
+		extracted = append(extracted, map[string]string{"member": name, "path": path})
+	}
+
+	exitCode := 0
+	missing := []string{}
+	for _, name := range selected.SortedValues() {
+		if !found.Has(name) {
+			fmt.Fprintf(os.Stderr, "%s: no member named '%s'\n", file, name)
+			missing = append(missing, name)
+			exitCode = 1
+		}
+	}
+	if *format == outputFormatJSON {
+		if err := writeJSON(map[string]interface{}{"file": file, "extracted": extracted, "missing": missing}); err != nil {
+			panic(err)
+		}
+	}
+	return exitCode
+}
+
+// memberBaseName returns the member name without directories, which may be
+// separated by '\' in COFF archives.
+func memberBaseName(name string) string {
+	if i := strings.LastIndexAny(name, "/\\"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func pack(args []string) int {
+	flags := pflag.NewFlagSet("pack", pflag.ExitOnError)
+	archiveFormat := flags.String("archive-format", "", "archive format, one of 'gnu', 'bsd' or 'coff'. default is the one native to the objects")
+	format := addFormatFlag(flags)
+	output := flags.String("output", "", "file path of output library")
+	setUsage(flags, "pack [options] <object>...")
+	flags.Parse(args)
+	if flags.NArg() == 0 || *output == "" {
+		flags.Usage()
+		return 2
+	}
+	if !validFormat(*format) {
+		return 2
+	}
+
+	switch *archiveFormat {
+	case "", ArchiveFormatGNU, ArchiveFormatBSD, ArchiveFormatCOFF:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown archive format '%s'\n", *archiveFormat)
+		return 2
+	}
+	if err := PackFiles(*output, flags.Args(), *archiveFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if *format == outputFormatJSON {
+		a, err := openArchive(*output, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		defer a.Close()
+		members := []string{}
+		for i := 0; i < a.NumMembers(); i++ {
+			members = append(members, a.MemberName(i))
+		}
+		if err := writeJSON(map[string]interface{}{"output": *output, "format": a.Format(), "members": members}); err != nil {
+			panic(err)
+		}
+	}
+	return 0
+}
+
+// archiveInfo is a library, or a slice of a universal library, printed by
+// 'info'.
+type archiveInfo struct {
+	Slice       string         `json:"slice,omitempty"`
+	Format      string         `json:"format"`
+	SymbolTable bool           `json:"symbolTable"`
+	Objects     map[string]int `json:"objects"`
+	Arches      []string       `json:"arches"`
+	Members     int            `json:"members"`
+	Defined     int            `json:"defined"`
+	Undefined   int            `json:"undefined"`
+}
+
+type fileInfo struct {
+	File      string        `json:"file"`
+	Universal []string      `json:"universal,omitempty"`
+	Slices    []archiveInfo `json:"slices"`
+	Error     string        `json:"error,omitempty"`
+}
+
+func info(args []string) int {
+	flags := pflag.NewFlagSet("info", pflag.ExitOnError)
+	arch := flags.String("arch", "", "architecture of universal binaries. default is all of them")
+	format := addFormatFlag(flags)
+	setUsage(flags, "info [options] <library or object>...")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if !validFormat(*format) {
+		return 2
+	}
+
+	exitCode := 0
+	files := []fileInfo{}
+	for _, file := range flags.Args() {
+		f := fileInfo{File: file, Slices: []archiveInfo{}}
+		arches := []string{*arch}
+		if *arch == "" {
+			universal, err := UniversalArches(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+				f.Error = err.Error()
+				exitCode = 1
+			} else if universal != nil {
+				f.Universal = universal
+				arches = universal
+			}
+		}
+		if f.Error == "" {
+			for _, a := range arches {
+				i, err := readInfo(file, a)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+					f.Error = err.Error()
+					exitCode = 1
+					continue
+				}
+				f.Slices = append(f.Slices, *i)
+			}
+		}
+		files = append(files, f)
+	}
+
+	if *format == outputFormatJSON {
+		if err := writeJSON(map[string]interface{}{"files": files}); err != nil {
+			panic(err)
+		}
+		return exitCode
+	}
+	for i, f := range files {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s:\n", f.File)
+		if f.Universal != nil {
+			fmt.Printf("  universal:    %s\n", strings.Join(f.Universal, ", "))
+		}
+		for _, slice := range f.Slices {
+			printInfo(&slice)
+		}
+	}
+	return exitCode
+}
+
+func readInfo(file string, arch string) (*archiveInfo, error) {
+	a, err := openArchive(file, arch)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+
+	i := &archiveInfo{Format: a.Format(), SymbolTable: a.HasSymbolTable(), Objects: make(map[string]int), Members: a.NumMembers()}
+	if len(a.Arches()) > 0 {
+		i.Slice = arch
+	}
+	arches := NewStringSet()
+	for j := 0; j < a.NumMembers(); j++ {
+		i.Objects[orDash(a.ObjectFormat(j))]++
+		if a.Arch(j) != "" {
+			arches.Put(a.Arch(j))
+		}
+		symbols := a.Symbols(j)
+		for k := range symbols {
+			if symbols[k].IsExportSymbol() {
+				i.Defined++
+			} else {
+				i.Undefined++
+			}
+		}
+	}
+	i.Arches = arches.SortedValues()
+	return i, nil
+}
+
+func printInfo(i *archiveInfo) {
+	if i.Slice != "" {
+		fmt.Printf("  slice:        %s\n", i.Slice)
+	}
+	fmt.Printf("  format:       %s\n", i.Format)
+	if i.Format != ArchiveFormatObject {
+		symbolTable := "no"
+		if i.SymbolTable {
+			symbolTable = "yes"
+		}
+		fmt.Printf("  symbol table: %s\n", symbolTable)
+	}
+
+	names := []string{}
+	for name := range i.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	objects := []string{}
+	for _, name := range names {
+		objects = append(objects, fmt.Sprintf("%s (%d)", name, i.Objects[name]))
+	}
+
+	fmt.Printf("  objects:      %s\n", strings.Join(objects, ", "))
+	fmt.Printf("  arch:         %s\n", orDash(strings.Join(i.Arches, ", ")))
+	fmt.Printf("  members:      %d\n", i.Members)
+	fmt.Printf("  symbols:      %d defined, %d undefined\n", i.Defined, i.Undefined)
+}
+
+// diff exits with 1 when the libraries differ, like diff(1).
+func diff(args []string) int {
+	flags := pflag.NewFlagSet("diff", pflag.ExitOnError)
+	arch := flags.String("arch", "", "architecture of universal binaries")
+	format := addFormatFlag(flags)
+	setUsage(flags, "diff [options] <old library> <new library>")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	if !validFormat(*format) {
+		return 2
+	}
+
+	files := []*Archive{}
+	for _, file := range flags.Args() {
+		a, err := openArchive(file, *arch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			return 2
+		}
+		defer a.Close()
+		files = append(files, a)
+	}
+	d, err := DiffLibraries(files[0], files[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	d.Old = flags.Arg(0)
+	d.New = flags.Arg(1)
+
+	if *format == outputFormatJSON {
+		err = d.WriteJSON(os.Stdout)
+	} else if !d.IsEmpty() {
+		err = d.WriteText(os.Stdout)
+	}
+	if err != nil {
+		panic(err)
+	}
+	if d.IsEmpty() {
+		return 0
+	}
+	return 1
+}
+
+func verify(args []string) int {
+	flags := pflag.NewFlagSet("verify", pflag.ExitOnError)
+	format := addFormatFlag(flags)
+	setUsage(flags, "verify [options] <library>...")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if !validFormat(*format) {
+		return 2
+	}
+
+	type verifiedFile struct {
+		File     string   `json:"file"`
+		Problems []string `json:"problems"`
+		Error    string   `json:"error,omitempty"`
+	}
+	exitCode := 0
+	files := []verifiedFile{}
+	for _, file := range flags.Args() {
+		problems, err := VerifyArchive(file)
+		f := verifiedFile{File: file, Problems: problems}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			f.Problems = []string{}
+			f.Error = err.Error()
+			exitCode = 1
+		} else if len(problems) > 0 {
+			exitCode = 1
+		}
+		files = append(files, f)
+		if *format == outputFormatJSON || err != nil {
+			continue
+		}
+		if len(problems) == 0 {
+			fmt.Printf("%s: OK\n", file)
+		} else {
+			printMessage(os.Stdout, file, problems)
+		}
+	}
+	if *format == outputFormatJSON {
+		if err := writeJSON(map[string]interface{}{"files": files}); err != nil {
+			panic(err)
+		}
+	}
+	return exitCode
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/kbinani/catlib"
+	"github.com/ogier/pflag"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+func addFormatFlag(flags *pflag.FlagSet) *string {
+	return flags.String("format", outputFormatText, "output format, 'text' or 'json'")
+}
+
+func validFormat(format string) bool {
+	if format == outputFormatText || format == outputFormatJSON {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "unknown output format '%s'\n", format)
+	return false
+}
+
+func writeJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", data)
+	return err
+}
+
+// mergeOutput prints messages of 'merge' as text, or records them in the
+// report with '--format=json'. In JSON mode, os.Stdout is redirected to
+// os.Stderr until the report is written, so that stdout has nothing but the
+// JSON document, even if lib or libtool prints something.
+type mergeOutput struct {
+	json   bool
+	stdout *os.File
+	report *MergeReport
+}
+
+func newMergeOutput(format string) *mergeOutput {
+	out := new(mergeOutput)
+	out.json = format == outputFormatJSON
+	out.report = NewMergeReport()
+	if out.json {
+		out.stdout = os.Stdout
+		os.Stdout = os.Stderr
+	}
+	return out
+}
+
+func (this *mergeOutput) warn(message string, items []string) {
+	if this.json {
+		this.report.Warn(message, items)
+	} else {
+		printMessage(os.Stderr, "Warning: "+message, items)
+	}
+}
+
+// abort prints the message to w in text mode, or records the failure in the
+// report. It returns the exit code of the failure.
+func (this *mergeOutput) abort(w io.Writer, message string, items []string) int {
+	if this.json {
+		this.report.Fail(message, items)
+	} else {
+		printMessage(w, "ABORT: "+message, items)
+	}
+	return 1
+}
+
+// fail is abort of an error, which is printed to stderr in text mode.
+func (this *mergeOutput) fail(err error) int {
+	if this.json {
+		this.report.Fail(err.Error(), nil)
+	} else {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+	return 1
+}
+
+// list prints a message with items in text mode only, because the report
+// has the same information in its fields.
+func (this *mergeOutput) list(w io.Writer, message string, items []string) {
+	if !this.json {
+		printMessage(w, message, items)
+	}
+}
+
+// finish writes the report in JSON mode. recovered is the value of a panic,
+// which is recorded as an error.
+func (this *mergeOutput) finish(elapsed time.Duration, recovered interface{}) {
+	if !this.json {
+		return
+	}
+	if recovered != nil {
+		this.report.Fail(fmt.Sprint(recovered), nil)
+	}
+	this.report.Timing.Total = elapsed.Seconds()
+	os.Stdout = this.stdout
+	if err := this.report.WriteJSON(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
+
+func printMessage(w io.Writer, message string, items []string) {
+	if len(items) == 0 {
+		fmt.Fprintf(w, "%s\n", message)
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", message)
+	for _, item := range items {
+		fmt.Fprintf(w, "  %s\n", item)
+	}
+}
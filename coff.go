@@ -0,0 +1,277 @@
+package catlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+const (
+	IMAGE_SYM_CLASS_END_OF_FUNCTION  = 0x00ff
+	IMAGE_SYM_CLASS_NULL             = 0x0000
+	IMAGE_SYM_CLASS_AUTOMATIC        = 0x0001
+	IMAGE_SYM_CLASS_EXTERNAL         = 0x0002
+	IMAGE_SYM_CLASS_STATIC           = 0x0003
+	IMAGE_SYM_CLASS_REGISTER         = 0x0004
+	IMAGE_SYM_CLASS_EXTERNAL_DEF     = 0x0005
+	IMAGE_SYM_CLASS_LABEL            = 0x0006
+	IMAGE_SYM_CLASS_UNDEFINED_LABEL  = 0x0007
+	IMAGE_SYM_CLASS_MEMBER_OF_STRUCT = 0x0008
+	IMAGE_SYM_CLASS_ARGUMENT         = 0x0009
+	IMAGE_SYM_CLASS_STRUCT_TAG       = 0x000A
+	IMAGE_SYM_CLASS_MEMBER_OF_UNION  = 0x000B
+	IMAGE_SYM_CLASS_UNION_TAG        = 0x000C
+	IMAGE_SYM_CLASS_TYPE_DEFINITION  = 0x000D
+	IMAGE_SYM_CLASS_UNDEFINED_STATIC = 0x000E
+	IMAGE_SYM_CLASS_ENUM_TAG         = 0x000F
+	IMAGE_SYM_CLASS_MEMBER_OF_ENUM   = 0x0010
+	IMAGE_SYM_CLASS_REGISTER_PARAM   = 0x0011
+	IMAGE_SYM_CLASS_BIT_FIELD        = 0x0012
+	IMAGE_SYM_CLASS_FAR_EXTERNAL     = 0x0044
+	IMAGE_SYM_CLASS_BLOCK            = 0x0064
+	IMAGE_SYM_CLASS_FUNCTION         = 0x0065
+	IMAGE_SYM_CLASS_END_OF_STRUCT    = 0x0066
+	IMAGE_SYM_CLASS_FILE             = 0x0067
+	IMAGE_SYM_CLASS_SECTION          = 0x0068
+	IMAGE_SYM_CLASS_WEAK_EXTERNAL    = 0x0069
+	IMAGE_SYM_CLASS_CLR_TOKEN        = 0x006B
+)
+
+func renameCOFFSymbols(data []byte, names map[string]string) ([]byte, error) {
+	h, err := readCOFFHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	stringTableOffset := h.pointerToSymbolTable + h.numberOfSymbols*h.symbolSize
+	if stringTableOffset+4 > len(data) {
+		return nil, fmt.Errorf("string table out of range")
+	}
+	stringTableSize := int(binary.LittleEndian.Uint32(data[stringTableOffset:]))
+	if stringTableSize < 4 {
+		stringTableSize = 4
+	}
+	stringTableEnd := stringTableOffset + stringTableSize
+	if stringTableEnd > len(data) {
+		return nil, fmt.Errorf("string table out of range")
+	}
+	if h.sectionTableOffset+h.numberOfSections*40 > len(data) {
+		return nil, fmt.Errorf("section table out of range")
+	}
+
+	ret := append([]byte{}, data[:stringTableOffset]...)
+	strtab := newStringTableBuilder(data[stringTableOffset:stringTableEnd])
+	changed := false
+
+	for i := 0; i < h.numberOfSymbols; i++ {
+		offset := h.pointerToSymbolTable + i*h.symbolSize
+		sym := ret[offset : offset+h.symbolSize]
+		storageClass := sym[h.symbolSize-2]
+		numberOfAuxSymbols := int(sym[h.symbolSize-1])
+
+		if storageClass == IMAGE_SYM_CLASS_EXTERNAL || storageClass == IMAGE_SYM_CLASS_WEAK_EXTERNAL {
+			name, err := coffSymbolName(sym, strtab.table)
+			if err != nil {
+				return nil, err
+			}
+			if newName, ok := names[name]; ok && newName != name {
+				if len(newName) <= 8 {
+					copy(sym[:8], make([]byte, 8))
+					copy(sym[:8], newName)
+				} else {
+					binary.LittleEndian.PutUint32(sym[0:4], 0)
+					binary.LittleEndian.PutUint32(sym[4:8], uint32(strtab.add(newName)))
+				}
+				changed = true
+			}
+		}
+
+		i += numberOfAuxSymbols
+	}
+
+	// '/EXPORT' and '/INCLUDE' of renamed symbols would be dangling.
+	var drectve []byte
+	drectveHeader := -1
+	drectveNumber := 0
+	for i := 0; i < h.numberOfSections; i++ {
+		header := ret[h.sectionTableOffset+i*40:]
+		if string(header[0:8]) != ".drectve" {
+			continue
+		}
+		size := int(binary.LittleEndian.Uint32(header[16:20]))
+		pointer := int(binary.LittleEndian.Uint32(header[20:24]))
+		if size == 0 || pointer+size > len(data) {
+			break
+		}
+		directives := ParseDirectives(data[pointer : pointer+size])
+		if renameDirectiveSymbols(directives, names) {
+			drectve = ReformatDirectives(data[pointer:pointer+size], directives)
+			drectveHeader = h.sectionTableOffset + i*40
+			drectveNumber = i + 1
+			changed = true
+		}
+		break
+	}
+
+	if !changed {
+		return nil, nil
+	}
+	binary.LittleEndian.PutUint32(strtab.table[0:4], uint32(len(strtab.table)))
+
+	// data after the string table, such as section contents placed there by
+	// some tools, is copied through, and pointers to it are moved.
+	shift := len(strtab.table) - stringTableSize
+	if shift != 0 {
+		for i := 0; i < h.numberOfSections; i++ {
+			header := ret[h.sectionTableOffset+i*40:]
+			for _, field := range []int{20, 24, 28} {
+				if pointer := int(binary.LittleEndian.Uint32(header[field:])); pointer >= stringTableEnd {
+					binary.LittleEndian.PutUint32(header[field:], uint32(pointer+shift))
+				}
+			}
+		}
+	}
+	ret = append(ret, strtab.table...)
+	ret = append(ret, data[stringTableEnd:]...)
+
+	if drectve != nil {
+		header := ret[drectveHeader:]
+		size := int(binary.LittleEndian.Uint32(header[16:20]))
+		pointer := int(binary.LittleEndian.Uint32(header[20:24]))
+		if len(drectve) <= size {
+			// overwrite in place, padded with spaces.
+			copy(ret[pointer:pointer+size], bytes.Repeat([]byte{' '}, size))
+			copy(ret[pointer:], drectve)
+		} else {
+			binary.LittleEndian.PutUint32(header[16:20], uint32(len(drectve)))
+			binary.LittleEndian.PutUint32(header[20:24], uint32(len(ret)))
+			ret = append(ret, drectve...)
+		}
+		updateCOFFSectionDefinition(ret, h, drectveNumber)
+	}
+	return ret, nil
+}
+
+// updateCOFFSectionDefinition updates length and checksum in the auxiliary
+// record of the section definition symbol, after the contents are changed.
+func updateCOFFSectionDefinition(data []byte, h coffHeader, number int) {
+	header := data[h.sectionTableOffset+(number-1)*40:]
+	size := int(binary.LittleEndian.Uint32(header[16:20]))
+	pointer := int(binary.LittleEndian.Uint32(header[20:24]))
+	for i := 0; i < h.numberOfSymbols; i++ {
+		sym := data[h.pointerToSymbolTable+i*h.symbolSize:]
+		numberOfAuxSymbols := int(sym[h.symbolSize-1])
+		if sym[h.symbolSize-2] == IMAGE_SYM_CLASS_STATIC && numberOfAuxSymbols > 0 && coffSectionNumber(sym, h) == number && binary.LittleEndian.Uint32(sym[8:12]) == 0 {
+			aux := sym[h.symbolSize:]
+			binary.LittleEndian.PutUint32(aux[0:4], uint32(size))
+			binary.LittleEndian.PutUint32(aux[8:12], jamCRC(data[pointer:pointer+size]))
+			return
+		}
+		i += numberOfAuxSymbols
+	}
+}
+
+// renameDirectiveSymbols renames symbols referred by '/EXPORT', '/INCLUDE'
+// and '/ALTERNATENAME' directives. Exports keep their exported names, as
+// 'entryname=newname'. It returns true when any directive is changed.
+func renameDirectiveSymbols(directives []Directive, names map[string]string) bool {
+	changed := false
+	rename := func(name string) string {
+		if newName, ok := names[name]; ok && newName != name {
+			changed = true
+			return newName
+		}
+		return name
+	}
+	for i := range directives {
+		d := &directives[i]
+		switch d.Name {
+		case DirectiveInclude:
+			d.Value = rename(d.Value)
+		case DirectiveExport:
+			value := d.Value
+			options := ""
+			if j := strings.Index(value, ","); j >= 0 {
+				value, options = value[:j], value[j:]
+			}
+			if j := strings.Index(value, "="); j >= 0 {
+				d.Value = value[:j+1] + rename(value[j+1:]) + options
+			} else if newName := rename(value); newName != value {
+				d.Value = value + "=" + newName + options
+			}
+		case DirectiveAlternateName:
+			if j := strings.Index(d.Value, "="); j >= 0 {
+				d.Value = rename(d.Value[:j]) + "=" + rename(d.Value[j+1:])
+			}
+		}
+	}
+	return changed
+}
+
+func coffSymbolName(sym []byte, stringTable []byte) (string, error) {
+	if binary.LittleEndian.Uint32(sym[0:4]) == 0 {
+		return cString(stringTable, int(binary.LittleEndian.Uint32(sym[4:8])))
+	}
+	name := sym[:8]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name), nil
+}
+
+type coffHeader struct {
+	bigobj               bool
+	numberOfSections     int
+	pointerToSymbolTable int
+	numberOfSymbols      int
+	symbolSize           int
+	sectionTableOffset   int
+}
+
+const (
+	IMAGE_SCN_LNK_COMDAT = 0x00001000
+)
+
+var bigobjClassID = []byte{0xc7, 0xa1, 0xba, 0xd1, 0xee, 0xba, 0xa9, 0x4b, 0xaf, 0x20, 0xfa, 0xf6, 0x6a, 0xa4, 0xdc, 0xb8}
+
+func readCOFFHeader(data []byte) (coffHeader, error) {
+	var h coffHeader
+	if len(data) < 20 {
+		return h, fmt.Errorf("too short for COFF header")
+	}
+	sig1 := binary.LittleEndian.Uint16(data[0:2])
+	sig2 := binary.LittleEndian.Uint16(data[2:4])
+	if sig1 == 0 && sig2 == 0xffff && len(data) >= 56 && bytes.Equal(data[12:28], bigobjClassID) {
+		h.bigobj = true
+		h.numberOfSections = int(binary.LittleEndian.Uint32(data[44:48]))
+		h.pointerToSymbolTable = int(binary.LittleEndian.Uint32(data[48:52]))
+		h.numberOfSymbols = int(binary.LittleEndian.Uint32(data[52:56]))
+		h.symbolSize = 20
+		h.sectionTableOffset = 56
+	} else {
+		h.numberOfSections = int(binary.LittleEndian.Uint16(data[2:4]))
+		h.pointerToSymbolTable = int(binary.LittleEndian.Uint32(data[8:12]))
+		h.numberOfSymbols = int(binary.LittleEndian.Uint32(data[12:16]))
+		h.symbolSize = 18
+		h.sectionTableOffset = 20 + int(binary.LittleEndian.Uint16(data[16:18]))
+	}
+	if h.pointerToSymbolTable == 0 || h.pointerToSymbolTable+h.numberOfSymbols*h.symbolSize > len(data) {
+		return h, fmt.Errorf("symbol table out of range")
+	}
+	return h, nil
+}
+
+// coffSectionNumber returns the 1-based section number of a symbol record.
+func coffSectionNumber(sym []byte, h coffHeader) int {
+	if h.bigobj {
+		return int(int32(binary.LittleEndian.Uint32(sym[12:16])))
+	}
+	return int(int16(binary.LittleEndian.Uint16(sym[12:14])))
+}
+
+// jamCRC is the checksum of COMDAT section contents used by MSVC, which is
+// CRC-32 without the final inversion.
+func jamCRC(data []byte) uint32 {
+	return ^crc32.ChecksumIEEE(data)
+}
@@ -0,0 +1,513 @@
+package catlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+const (
+	IMAGE_SCN_LNK_NRELOC_OVFL = 0x01000000
+
+	IMAGE_SYM_UNDEFINED = 0
+	IMAGE_SYM_ABSOLUTE  = -1
+	IMAGE_SYM_DEBUG     = -2
+
+	IMAGE_COMDAT_SELECT_ASSOCIATIVE = 5
+)
+
+// COFFObject is an editable model of a COFF object file, either regular or
+// bigobj. Relocations and auxiliary records refer to symbols and sections by
+// pointers, so sections and symbols can be added or removed freely before
+// serializing the object with Bytes.
+type COFFObject struct {
+	BigObj          bool
+	Machine         uint16
+	TimeDateStamp   uint32
+	Characteristics uint16
+	Sections        []*COFFSection
+	Symbols         []*COFFSymbol
+	// optional header of a regular object, or fields of bigobj header
+	// following the signatures, as is.
+	header []byte
+}
+
+type COFFSection struct {
+	Name            string
+	VirtualSize     uint32
+	VirtualAddress  uint32
+	Characteristics uint32
+	// raw data. nil for uninitialized data, whose size is Size.
+	Data        []byte
+	Size        uint32
+	Relocations []*COFFRelocation
+	// line numbers, as is. They are deprecated and hardly used.
+	LineNumbers []byte
+	loadedData  []byte
+}
+
+type COFFRelocation struct {
+	VirtualAddress uint32
+	Symbol         *COFFSymbol
+	Type           uint16
+}
+
+type COFFSymbol struct {
+	Name  string
+	Value uint32
+	// section defining the symbol, or nil. SectionNumber is used instead
+	// for undefined, absolute and debug symbols.
+	Section       *COFFSection
+	SectionNumber int32
+	Type          uint16
+	StorageClass  uint8
+	// auxiliary records, each of which has the size of a symbol record.
+	Aux [][]byte
+	// default symbol of a weak external.
+	weakDefault *COFFSymbol
+	// associated section of an associative COMDAT section definition.
+	associated *COFFSection
+}
+
+// IsSectionDefinition returns true for the symbol of a section, which has a
+// section definition auxiliary record.
+func (this *COFFSymbol) IsSectionDefinition() bool {
+	return this.StorageClass == IMAGE_SYM_CLASS_STATIC && this.Section != nil && this.Value == 0 && len(this.Aux) > 0 && this.Name == this.Section.Name
+}
+
+// ReadCOFFObject parses a COFF object file.
+func ReadCOFFObject(data []byte) (*COFFObject, error) {
+	h, err := readCOFFHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	obj := new(COFFObject)
+	obj.BigObj = h.bigobj
+	if h.bigobj {
+		obj.Machine = binary.LittleEndian.Uint16(data[6:8])
+		obj.TimeDateStamp = binary.LittleEndian.Uint32(data[8:12])
+		obj.header = append([]byte{}, data[4:44]...)
+	} else {
+		obj.Machine = binary.LittleEndian.Uint16(data[0:2])
+		obj.TimeDateStamp = binary.LittleEndian.Uint32(data[4:8])
+		obj.Characteristics = binary.LittleEndian.Uint16(data[18:20])
+		obj.header = append([]byte{}, data[20:h.sectionTableOffset]...)
+	}
+
+	stringTableOffset := h.pointerToSymbolTable + h.numberOfSymbols*h.symbolSize
+	stringTable := []byte{0, 0, 0, 0}
+	if stringTableOffset+4 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[stringTableOffset:]))
+		if size >= 4 && stringTableOffset+size <= len(data) {
+			stringTable = data[stringTableOffset : stringTableOffset+size]
+		}
+	}
+
+	if h.sectionTableOffset+h.numberOfSections*40 > len(data) {
+		return nil, fmt.Errorf("section table out of range")
+	}
+	for i := 0; i < h.numberOfSections; i++ {
+		header := data[h.sectionTableOffset+i*40:]
+		section := new(COFFSection)
+		name, err := coffSectionName(header[:8], stringTable)
+		if err != nil {
+			return nil, err
+		}
+		section.Name = name
+		section.VirtualSize = binary.LittleEndian.Uint32(header[8:12])
+		section.VirtualAddress = binary.LittleEndian.Uint32(header[12:16])
+		section.Size = binary.LittleEndian.Uint32(header[16:20])
+		section.Characteristics = binary.LittleEndian.Uint32(header[36:40])
+		if p := int(binary.LittleEndian.Uint32(header[20:24])); p != 0 {
+			if p+int(section.Size) > len(data) {
+				return nil, fmt.Errorf("raw data of section '%s' out of range", name)
+			}
+			section.Data = append([]byte{}, data[p:p+int(section.Size)]...)
+			section.loadedData = data[p : p+int(section.Size)]
+		}
+		if p := int(binary.LittleEndian.Uint32(header[28:32])); p != 0 {
+			n := int(binary.LittleEndian.Uint16(header[34:36]))
+			if p+n*6 > len(data) {
+				return nil, fmt.Errorf("line numbers of section '%s' out of range", name)
+			}
+			section.LineNumbers = append([]byte{}, data[p:p+n*6]...)
+		}
+		obj.Sections = append(obj.Sections, section)
+	}
+
+	// symbols by their index in the symbol table. aux records have nil.
+	symbols := make([]*COFFSymbol, h.numberOfSymbols)
+	weakDefaults := make(map[*COFFSymbol]int)
+	associations := make(map[*COFFSymbol]int)
+	for i := 0; i < h.numberOfSymbols; i++ {
+		record := data[h.pointerToSymbolTable+i*h.symbolSize:]
+		sym := new(COFFSymbol)
+		name, err := coffSymbolName(record, stringTable)
+		if err != nil {
+			return nil, err
+		}
+		sym.Name = name
+		sym.Value = binary.LittleEndian.Uint32(record[8:12])
+		sym.SectionNumber = int32(coffSectionNumber(record, h))
+		if sym.SectionNumber > 0 {
+			if int(sym.SectionNumber) > len(obj.Sections) {
+				return nil, fmt.Errorf("symbol '%s' has invalid section number %d", name, sym.SectionNumber)
+			}
+			sym.Section = obj.Sections[sym.SectionNumber-1]
+		}
+		sym.Type = binary.LittleEndian.Uint16(record[h.symbolSize-4:])
+		sym.StorageClass = record[h.symbolSize-2]
+		numberOfAuxSymbols := int(record[h.symbolSize-1])
+		if i+numberOfAuxSymbols >= h.numberOfSymbols {
+			return nil, fmt.Errorf("aux records of symbol '%s' out of range", name)
+		}
+		for j := 1; j <= numberOfAuxSymbols; j++ {
+			offset := h.pointerToSymbolTable + (i+j)*h.symbolSize
+			sym.Aux = append(sym.Aux, append([]byte{}, data[offset:offset+h.symbolSize]...))
+		}
+		if sym.StorageClass == IMAGE_SYM_CLASS_WEAK_EXTERNAL && len(sym.Aux) > 0 {
+			weakDefaults[sym] = int(binary.LittleEndian.Uint32(sym.Aux[0][0:4]))
+		}
+		if sym.IsSectionDefinition() && sym.Aux[0][14] == IMAGE_COMDAT_SELECT_ASSOCIATIVE {
+			number := int(binary.LittleEndian.Uint16(sym.Aux[0][12:14]))
+			if h.bigobj {
+				number |= int(binary.LittleEndian.Uint16(sym.Aux[0][16:18])) << 16
+			}
+			associations[sym] = number
+		}
+		symbols[i] = sym
+		obj.Symbols = append(obj.Symbols, sym)
+		i += numberOfAuxSymbols
+	}
+	for sym, index := range weakDefaults {
+		if index >= len(symbols) || symbols[index] == nil {
+			return nil, fmt.Errorf("weak external '%s' has invalid tag index %d", sym.Name, index)
+		}
+		sym.weakDefault = symbols[index]
+	}
+	for sym, number := range associations {
+		if number < 1 || number > len(obj.Sections) {
+			return nil, fmt.Errorf("section '%s' is associated with invalid section %d", sym.Name, number)
+		}
+		sym.associated = obj.Sections[number-1]
+	}
+
+	for i, section := range obj.Sections {
+		header := data[h.sectionTableOffset+i*40:]
+		p := int(binary.LittleEndian.Uint32(header[24:28]))
+		n := int(binary.LittleEndian.Uint16(header[32:34]))
+		if p == 0 {
+			continue
+		}
+		if section.Characteristics&IMAGE_SCN_LNK_NRELOC_OVFL != 0 && p+10 <= len(data) {
+			// the actual number is in the first relocation, which counts itself.
+			n = int(binary.LittleEndian.Uint32(data[p:])) - 1
+			p += 10
+		}
+		if p+n*10 > len(data) {
+			return nil, fmt.Errorf("relocations of section '%s' out of range", section.Name)
+		}
+		for j := 0; j < n; j++ {
+			record := data[p+j*10:]
+			index := int(binary.LittleEndian.Uint32(record[4:8]))
+			if index >= len(symbols) || symbols[index] == nil {
+				return nil, fmt.Errorf("relocation of section '%s' has invalid symbol index %d", section.Name, index)
+			}
+			section.Relocations = append(section.Relocations, &COFFRelocation{
+				VirtualAddress: binary.LittleEndian.Uint32(record[0:4]),
+				Symbol:         symbols[index],
+				Type:           binary.LittleEndian.Uint16(record[8:10]),
+			})
+		}
+	}
+	return obj, nil
+}
+
+func coffSectionName(name []byte, stringTable []byte) (string, error) {
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	s := string(name)
+	if len(s) > 2 && s[:2] == "//" {
+		offset, err := decodeCOFFBase64(s[2:])
+		if err != nil {
+			return "", err
+		}
+		return cString(stringTable, offset)
+	}
+	if len(s) > 1 && s[0] == '/' {
+		offset, err := strconv.Atoi(s[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid section name '%s'", s)
+		}
+		return cString(stringTable, offset)
+	}
+	return s, nil
+}
+
+const coffBase64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// decodeCOFFBase64 decodes string table offset of a long section name in
+// the form of '//' followed by 6 base64 digits, most significant first.
+func decodeCOFFBase64(s string) (int, error) {
+	ret := 0
+	for i := 0; i < len(s); i++ {
+		digit := bytes.IndexByte([]byte(coffBase64Alphabet), s[i])
+		if digit < 0 {
+			return 0, fmt.Errorf("invalid section name '//%s'", s)
+		}
+		ret = ret*64 + digit
+	}
+	return ret, nil
+}
+
+func encodeCOFFBase64(offset int) string {
+	ret := make([]byte, 6)
+	for i := 5; i >= 0; i-- {
+		ret[i] = coffBase64Alphabet[offset%64]
+		offset /= 64
+	}
+	return string(ret)
+}
+
+// Section returns the first section with the name, or nil.
+func (this *COFFObject) Section(name string) *COFFSection {
+	for _, section := range this.Sections {
+		if section.Name == name {
+			return section
+		}
+	}
+	return nil
+}
+
+// RemoveSection removes the section, and the static symbols defined in it.
+// It fails when the section is still referenced from other sections.
+func (this *COFFObject) RemoveSection(section *COFFSection) error {
+	removed := make(map[*COFFSymbol]bool)
+	for _, sym := range this.Symbols {
+		if sym.Section != section {
+			continue
+		}
+		if sym.StorageClass == IMAGE_SYM_CLASS_EXTERNAL {
+			return fmt.Errorf("section '%s' defines external symbol '%s'", section.Name, sym.Name)
+		}
+		removed[sym] = true
+	}
+	for _, s := range this.Sections {
+		if s == section {
+			continue
+		}
+		for _, r := range s.Relocations {
+			if removed[r.Symbol] {
+				return fmt.Errorf("section '%s' is referenced from section '%s'", section.Name, s.Name)
+			}
+		}
+	}
+	for _, sym := range this.Symbols {
+		if sym.associated == section || (sym.weakDefault != nil && removed[sym.weakDefault]) {
+			return fmt.Errorf("section '%s' is referenced from symbol '%s'", section.Name, sym.Name)
+		}
+	}
+
+	sections := []*COFFSection{}
+	for _, s := range this.Sections {
+		if s != section {
+			sections = append(sections, s)
+		}
+	}
+	this.Sections = sections
+	symbols := []*COFFSymbol{}
+	for _, sym := range this.Symbols {
+		if !removed[sym] {
+			symbols = append(symbols, sym)
+		}
+	}
+	this.Symbols = symbols
+	return nil
+}
+
+// Bytes serializes the object. Raw data, relocations and line numbers of
+// each section are placed after the section table in order, followed by the
+// symbol table and the string table.
+func (this *COFFObject) Bytes() ([]byte, error) {
+	symbolSize := 18
+	headerSize := 20 + len(this.header)
+	if this.BigObj {
+		symbolSize = 20
+		headerSize = 56
+	}
+
+	sectionIndex := make(map[*COFFSection]int)
+	for i, section := range this.Sections {
+		sectionIndex[section] = i + 1
+	}
+	symbolIndex := make(map[*COFFSymbol]int)
+	numberOfSymbols := 0
+	for _, sym := range this.Symbols {
+		symbolIndex[sym] = numberOfSymbols
+		numberOfSymbols += 1 + len(sym.Aux)
+	}
+
+	strtab := newStringTableBuilder([]byte{0, 0, 0, 0})
+	ret := make([]byte, headerSize+len(this.Sections)*40)
+	// section headers are copied into ret at the end, because ret grows.
+	headers := make([]byte, len(this.Sections)*40)
+
+	for i, section := range this.Sections {
+		header := headers[i*40:]
+		if len(section.Name) <= 8 {
+			copy(header[:8], section.Name)
+		} else if offset := strtab.add(section.Name); offset <= 9999999 {
+			copy(header[:8], "/"+strconv.Itoa(offset))
+		} else {
+			copy(header[:8], "//"+encodeCOFFBase64(offset))
+		}
+		binary.LittleEndian.PutUint32(header[8:12], section.VirtualSize)
+		binary.LittleEndian.PutUint32(header[12:16], section.VirtualAddress)
+
+		characteristics := section.Characteristics &^ IMAGE_SCN_LNK_NRELOC_OVFL
+		if section.Data != nil {
+			binary.LittleEndian.PutUint32(header[16:20], uint32(len(section.Data)))
+			if len(section.Data) > 0 {
+				binary.LittleEndian.PutUint32(header[20:24], uint32(len(ret)))
+				ret = append(ret, section.Data...)
+			}
+		} else {
+			binary.LittleEndian.PutUint32(header[16:20], section.Size)
+		}
+
+		if n := len(section.Relocations); n > 0 {
+			binary.LittleEndian.PutUint32(header[24:28], uint32(len(ret)))
+			if n >= 0xffff {
+				characteristics |= IMAGE_SCN_LNK_NRELOC_OVFL
+				binary.LittleEndian.PutUint16(header[32:34], 0xffff)
+				record := make([]byte, 10)
+				binary.LittleEndian.PutUint32(record[0:4], uint32(n+1))
+				ret = append(ret, record...)
+			} else {
+				binary.LittleEndian.PutUint16(header[32:34], uint16(n))
+			}
+			for _, r := range section.Relocations {
+				index, ok := symbolIndex[r.Symbol]
+				if !ok {
+					return nil, fmt.Errorf("relocation of section '%s' refers removed symbol '%s'", section.Name, r.Symbol.Name)
+				}
+				record := make([]byte, 10)
+				binary.LittleEndian.PutUint32(record[0:4], r.VirtualAddress)
+				binary.LittleEndian.PutUint32(record[4:8], uint32(index))
+				binary.LittleEndian.PutUint16(record[8:10], r.Type)
+				ret = append(ret, record...)
+			}
+		}
+
+		if len(section.LineNumbers) > 0 {
+			binary.LittleEndian.PutUint32(header[28:32], uint32(len(ret)))
+			binary.LittleEndian.PutUint16(header[34:36], uint16(len(section.LineNumbers)/6))
+			ret = append(ret, section.LineNumbers...)
+		}
+		binary.LittleEndian.PutUint32(header[36:40], characteristics)
+	}
+
+	pointerToSymbolTable := len(ret)
+	for _, sym := range this.Symbols {
+		record := make([]byte, symbolSize)
+		if len(sym.Name) <= 8 {
+			copy(record[:8], sym.Name)
+		} else {
+			binary.LittleEndian.PutUint32(record[4:8], uint32(strtab.add(sym.Name)))
+		}
+		binary.LittleEndian.PutUint32(record[8:12], sym.Value)
+		sectionNumber := sym.SectionNumber
+		if sym.Section != nil {
+			index, ok := sectionIndex[sym.Section]
+			if !ok {
+				return nil, fmt.Errorf("symbol '%s' refers removed section '%s'", sym.Name, sym.Section.Name)
+			}
+			sectionNumber = int32(index)
+		}
+		if this.BigObj {
+			binary.LittleEndian.PutUint32(record[12:16], uint32(sectionNumber))
+		} else {
+			binary.LittleEndian.PutUint16(record[12:14], uint16(int16(sectionNumber)))
+		}
+		binary.LittleEndian.PutUint16(record[symbolSize-4:], sym.Type)
+		record[symbolSize-2] = sym.StorageClass
+		record[symbolSize-1] = byte(len(sym.Aux))
+		ret = append(ret, record...)
+
+		for j, aux := range sym.Aux {
+			aux = append([]byte{}, aux...)
+			if j == 0 && sym.weakDefault != nil {
+				index, ok := symbolIndex[sym.weakDefault]
+				if !ok {
+					return nil, fmt.Errorf("weak external '%s' refers removed symbol '%s'", sym.Name, sym.weakDefault.Name)
+				}
+				binary.LittleEndian.PutUint32(aux[0:4], uint32(index))
+			}
+			if j == 0 && sym.IsSectionDefinition() {
+				sym.updateSectionDefinition(aux, sectionIndex, this.BigObj)
+			}
+			ret = append(ret, aux...)
+		}
+	}
+
+	binary.LittleEndian.PutUint32(strtab.table[0:4], uint32(len(strtab.table)))
+	ret = append(ret, strtab.table...)
+	copy(ret[headerSize:], headers)
+
+	if this.BigObj {
+		binary.LittleEndian.PutUint16(ret[0:2], 0)
+		binary.LittleEndian.PutUint16(ret[2:4], 0xffff)
+		copy(ret[4:44], this.header)
+		binary.LittleEndian.PutUint16(ret[6:8], this.Machine)
+		binary.LittleEndian.PutUint32(ret[8:12], this.TimeDateStamp)
+		binary.LittleEndian.PutUint32(ret[44:48], uint32(len(this.Sections)))
+		binary.LittleEndian.PutUint32(ret[48:52], uint32(pointerToSymbolTable))
+		binary.LittleEndian.PutUint32(ret[52:56], uint32(numberOfSymbols))
+	} else {
+		if len(this.Sections) > 0xffff {
+			return nil, fmt.Errorf("too many sections for regular object: %d", len(this.Sections))
+		}
+		binary.LittleEndian.PutUint16(ret[0:2], this.Machine)
+		binary.LittleEndian.PutUint16(ret[2:4], uint16(len(this.Sections)))
+		binary.LittleEndian.PutUint32(ret[4:8], this.TimeDateStamp)
+		binary.LittleEndian.PutUint32(ret[8:12], uint32(pointerToSymbolTable))
+		binary.LittleEndian.PutUint32(ret[12:16], uint32(numberOfSymbols))
+		binary.LittleEndian.PutUint16(ret[16:18], uint16(len(this.header)))
+		binary.LittleEndian.PutUint16(ret[18:20], this.Characteristics)
+		copy(ret[20:], this.header)
+	}
+	return ret, nil
+}
+
+// updateSectionDefinition updates length, number of relocations and line
+// numbers, checksum and the associated section in the aux record. The
+// checksum is recomputed only when the contents have been modified.
+func (this *COFFSymbol) updateSectionDefinition(aux []byte, sectionIndex map[*COFFSection]int, bigobj bool) {
+	section := this.Section
+	if section.Data != nil {
+		binary.LittleEndian.PutUint32(aux[0:4], uint32(len(section.Data)))
+	}
+	numberOfRelocations := len(section.Relocations)
+	if numberOfRelocations > 0xffff {
+		numberOfRelocations = 0xffff
+	}
+	binary.LittleEndian.PutUint16(aux[4:6], uint16(numberOfRelocations))
+	binary.LittleEndian.PutUint16(aux[6:8], uint16(len(section.LineNumbers)/6))
+	if coffAuxChecksum(aux) != 0 && !bytes.Equal(section.Data, section.loadedData) {
+		binary.LittleEndian.PutUint32(aux[8:12], jamCRC(section.Data))
+	}
+	if this.associated != nil {
+		number := sectionIndex[this.associated]
+		binary.LittleEndian.PutUint16(aux[12:14], uint16(number))
+		if bigobj {
+			binary.LittleEndian.PutUint16(aux[16:18], uint16(number>>16))
+		}
+	}
+}
+
+// coffAuxChecksum returns checksum field of a section definition record.
+func coffAuxChecksum(aux []byte) uint32 {
+	return binary.LittleEndian.Uint32(aux[8:12])
+}
@@ -0,0 +1,227 @@
+package catlib
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// readPETestData reads an object in testdata of debug/pe package, or skips
+// the test when it is not available.
+func readPETestData(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join(runtime.GOROOT(), "src", "debug", "pe", "testdata", name))
+	if os.IsNotExist(err) {
+		t.Skipf("%s not found", name)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// describeCOFFObject returns sections and symbols of the object in a
+// comparable form, which refers sections and symbols by their names.
+func describeCOFFObject(obj *COFFObject) []string {
+	ret := []string{}
+	for _, section := range obj.Sections {
+		// Size is only for uninitialized data.
+		size := len(section.Data)
+		if section.Data == nil {
+			size = int(section.Size)
+		}
+		ret = append(ret, fmt.Sprintf("section %s size=%d characteristics=%x data=%x lines=%x", section.Name, size, section.Characteristics, section.Data, section.LineNumbers))
+		for _, r := range section.Relocations {
+			ret = append(ret, fmt.Sprintf("  reloc %x %s type=%d", r.VirtualAddress, r.Symbol.Name, r.Type))
+		}
+	}
+	for _, sym := range obj.Symbols {
+		section := fmt.Sprint(sym.SectionNumber)
+		if sym.Section != nil {
+			section = sym.Section.Name
+		}
+		ret = append(ret, fmt.Sprintf("symbol %s value=%x section=%s type=%x class=%d aux=%d", sym.Name, sym.Value, section, sym.Type, sym.StorageClass, len(sym.Aux)))
+	}
+	return ret
+}
+
+type peRelocation struct {
+	VirtualAddress uint32
+	Symbol         string
+	Type           uint16
+}
+
+// readPERelocations reads relocations of each section with debug/pe, whose
+// symbols are resolved by the symbol table index.
+func readPERelocations(t *testing.T, data []byte) map[string][]peRelocation {
+	f, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := make(map[string][]peRelocation)
+	for _, section := range f.Sections {
+		for _, r := range section.Relocs {
+			if int(r.SymbolTableIndex) >= len(f.COFFSymbols) {
+				t.Fatalf("relocation of '%s' has invalid symbol index %d", section.Name, r.SymbolTableIndex)
+			}
+			name, err := f.COFFSymbols[r.SymbolTableIndex].FullName(f.StringTable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ret[section.Name] = append(ret[section.Name], peRelocation{r.VirtualAddress, name, r.Type})
+		}
+	}
+	return ret
+}
+
+func TestCOFFObjectRoundTrip(t *testing.T) {
+	for _, name := range []string{"gcc-amd64-mingw-obj", "gcc-386-mingw-obj"} {
+		data := readPETestData(t, name)
+		obj, err := ReadCOFFObject(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out, err := obj.Bytes()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		again, err := ReadCOFFObject(out)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, want := describeCOFFObject(again), describeCOFFObject(obj); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: round trip differs\ngot:  %q\nwant: %q", name, got, want)
+		}
+
+		// symbol indices are kept, so are raw symbol records except names.
+		original, err := pe.NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		written, err := pe.NewFile(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("%s: debug/pe cannot read the written object: %v", name, err)
+		}
+		if len(written.COFFSymbols) != len(original.COFFSymbols) {
+			t.Fatalf("%s: %d symbol records, want %d", name, len(written.COFFSymbols), len(original.COFFSymbols))
+		}
+		if got, want := readPERelocations(t, out), readPERelocations(t, data); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: relocations %v, want %v", name, got, want)
+		}
+		for i, section := range written.Sections {
+			got, _ := section.Data()
+			want, _ := original.Sections[i].Data()
+			if section.Name != original.Sections[i].Name || !bytes.Equal(got, want) {
+				t.Errorf("%s: section #%d '%s' differs from '%s'", name, i, section.Name, original.Sections[i].Name)
+			}
+		}
+	}
+}
+
+// growing a section moves the following contents, and adding a symbol
+// shifts indices of the following ones.
+func TestCOFFObjectGrowSection(t *testing.T) {
+	data := readPETestData(t, "gcc-amd64-mingw-obj")
+	obj, err := ReadCOFFObject(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := obj.Section(".text")
+	if text == nil {
+		t.Fatal("'.text' not found")
+	}
+	size := len(text.Data)
+	text.Data = append(text.Data, bytes.Repeat([]byte{0xcc}, 100)...)
+	added := &COFFSymbol{Name: "a_symbol_with_a_long_name", Value: uint32(size), Section: text, StorageClass: IMAGE_SYM_CLASS_STATIC}
+	obj.Symbols = append([]*COFFSymbol{added}, obj.Symbols...)
+
+	out, err := obj.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readPERelocations(t, out), readPERelocations(t, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("relocations %v, want %v", got, want)
+	}
+
+	original, err := pe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := pe.NewFile(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Section(".text").Size; got != uint32(size+100) {
+		t.Errorf("size of '.text' is %d, want %d", got, size+100)
+	}
+	for _, section := range f.Sections {
+		got, _ := section.Data()
+		want, _ := original.Section(section.Name).Data()
+		if section.Name == ".text" {
+			want = append(want, bytes.Repeat([]byte{0xcc}, 100)...)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("contents of '%s' differ", section.Name)
+		}
+	}
+
+	again, err := ReadCOFFObject(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Symbols[0].Name != added.Name {
+		t.Errorf("first symbol is '%s', want '%s'", again.Symbols[0].Name, added.Name)
+	}
+	for _, sym := range again.Symbols {
+		if sym.IsSectionDefinition() && sym.Section.Name == ".text" {
+			if got := binary.LittleEndian.Uint32(sym.Aux[0][0:4]); got != uint32(size+100) {
+				t.Errorf("section definition of '.text' has length %d, want %d", got, size+100)
+			}
+		}
+	}
+}
+
+// testdata/gcc-amd64-mingw-bigobj.obj is gcc-amd64-mingw-obj of debug/pe
+// converted by 'objcopy -O pe-bigobj-x86-64'.
+func TestCOFFObjectBigObj(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "gcc-amd64-mingw-bigobj.obj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := ReadCOFFObject(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !obj.BigObj {
+		t.Fatal("not read as bigobj")
+	}
+	regular, err := ReadCOFFObject(readPETestData(t, "gcc-amd64-mingw-obj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := describeCOFFObject(obj), describeCOFFObject(regular); !reflect.DeepEqual(got, want) {
+		t.Errorf("bigobj differs from the regular object\ngot:  %q\nwant: %q", got, want)
+	}
+
+	obj.Section(".text").Data = append(obj.Section(".text").Data, 0xcc)
+	out, err := obj.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out[:4], []byte{0, 0, 0xff, 0xff}) || !bytes.Equal(out[4:44], data[4:44]) {
+		t.Errorf("bigobj header is not kept: %x", out[:44])
+	}
+	again, err := ReadCOFFObject(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := describeCOFFObject(again), describeCOFFObject(obj); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip differs\ngot:  %q\nwant: %q", got, want)
+	}
+}
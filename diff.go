@@ -0,0 +1,244 @@
+package catlib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LibraryDiff is the structural difference between two libraries. Members
+// are matched by name, and the n-th member of the same name is named as
+// 'name (n)' for n >= 2.
+type LibraryDiff struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+	// architectures of members, which appear only in either library.
+	AddedArches   []string     `json:"addedArches"`
+	RemovedArches []string     `json:"removedArches"`
+	Added         []DiffMember `json:"added"`
+	Removed       []DiffMember `json:"removed"`
+	// members with different contents.
+	Changed []MemberDiff `json:"changed"`
+}
+
+type DiffMember struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// sha256 of the contents.
+	Hash string `json:"hash"`
+	Arch string `json:"arch,omitempty"`
+	// defined symbols.
+	Exports []string `json:"exports"`
+	// undefined symbols.
+	Imports []string `json:"imports"`
+	// linker directives in '.drectve' section.
+	Directives []string `json:"directives"`
+}
+
+type MemberDiff struct {
+	Name    string `json:"name"`
+	OldSize int64  `json:"oldSize"`
+	NewSize int64  `json:"newSize"`
+	OldHash string `json:"oldHash"`
+	NewHash string `json:"newHash"`
+	// empty when the architecture is not changed.
+	OldArch           string   `json:"oldArch,omitempty"`
+	NewArch           string   `json:"newArch,omitempty"`
+	AddedExports      []string `json:"addedExports"`
+	RemovedExports    []string `json:"removedExports"`
+	AddedImports      []string `json:"addedImports"`
+	RemovedImports    []string `json:"removedImports"`
+	AddedDirectives   []string `json:"addedDirectives"`
+	RemovedDirectives []string `json:"removedDirectives"`
+}
+
+type diffMember struct {
+	DiffMember
+	imports    *StringSet
+	exports    *StringSet
+	directives *StringSet
+}
+
+// DiffLibraries compares members of two libraries. Architectures are
+// compared when the libraries have 'Arch(memberIndex int) string' method,
+// like Archive.
+func DiffLibraries(oldFile, newFile ILibFile) (*LibraryDiff, error) {
+	oldMembers, err := readDiffMembers(oldFile)
+	if err != nil {
+		return nil, err
+	}
+	newMembers, err := readDiffMembers(newFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := new(LibraryDiff)
+	ret.Added = []DiffMember{}
+	ret.Removed = []DiffMember{}
+	ret.Changed = []MemberDiff{}
+
+	oldArches := NewStringSet()
+	newArches := NewStringSet()
+	index := make(map[string]*diffMember)
+	for _, m := range oldMembers {
+		index[m.Name] = m
+		if m.Arch != "" {
+			oldArches.Put(m.Arch)
+		}
+	}
+	found := NewStringSet()
+	for _, m := range newMembers {
+		if m.Arch != "" {
+			newArches.Put(m.Arch)
+		}
+		o, ok := index[m.Name]
+		if !ok {
+			ret.Added = append(ret.Added, m.DiffMember)
+			continue
+		}
+		found.Put(m.Name)
+		if o.Hash == m.Hash {
+			continue
+		}
+		d := MemberDiff{Name: m.Name, OldSize: o.Size, NewSize: m.Size, OldHash: o.Hash, NewHash: m.Hash}
+		if o.Arch != m.Arch {
+			d.OldArch = o.Arch
+			d.NewArch = m.Arch
+		}
+		d.AddedExports, d.RemovedExports = diffStringSets(o.exports, m.exports)
+		d.AddedImports, d.RemovedImports = diffStringSets(o.imports, m.imports)
+		d.AddedDirectives, d.RemovedDirectives = diffStringSets(o.directives, m.directives)
+		ret.Changed = append(ret.Changed, d)
+	}
+	for _, m := range oldMembers {
+		if !found.Has(m.Name) {
+			ret.Removed = append(ret.Removed, m.DiffMember)
+		}
+	}
+	ret.AddedArches, ret.RemovedArches = diffStringSets(oldArches, newArches)
+	return ret, nil
+}
+
+func readDiffMembers(file ILibFile) ([]*diffMember, error) {
+	arch, _ := file.(interface {
+		Arch(memberIndex int) string
+	})
+	count := make(map[string]int)
+	ret := []*diffMember{}
+	for i := 0; i < file.NumMembers(); i++ {
+		var buf bytes.Buffer
+		if err := file.Extract(i, &buf); err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256(buf.Bytes())
+
+		m := new(diffMember)
+		m.Name = file.MemberName(i)
+		count[m.Name]++
+		if n := count[m.Name]; n > 1 {
+			m.Name = fmt.Sprintf("%s (%d)", m.Name, n)
+		}
+		m.Size = file.MemberSize(i)
+		m.Hash = hex.EncodeToString(hash[:])
+		if arch != nil {
+			m.Arch = arch.Arch(i)
+		}
+		m.exports = NewStringSet()
+		for _, sym := range file.ExportSymbols(i) {
+			m.exports.Put(sym.Name())
+		}
+		m.Exports = m.exports.SortedValues()
+		m.imports = NewStringSet()
+		for _, sym := range file.ImportSymbols(i) {
+			m.imports.Put(sym.Name())
+		}
+		m.Imports = m.imports.SortedValues()
+		m.directives = NewStringSet()
+		for _, d := range file.Directives(i) {
+			m.directives.Put(d.String())
+		}
+		m.Directives = m.directives.SortedValues()
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
+
+// diffStringSets returns sorted values only in b, and only in a.
+func diffStringSets(a, b *StringSet) (added []string, removed []string) {
+	added = []string{}
+	removed = []string{}
+	for _, s := range b.SortedValues() {
+		if !a.Has(s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a.SortedValues() {
+		if !b.Has(s) {
+			removed = append(removed, s)
+		}
+	}
+	return
+}
+
+// IsEmpty returns true when the libraries have the same members.
+func (this *LibraryDiff) IsEmpty() bool {
+	return len(this.Added) == 0 && len(this.Removed) == 0 && len(this.Changed) == 0 && len(this.AddedArches) == 0 && len(this.RemovedArches) == 0
+}
+
+func (this *LibraryDiff) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// WriteText writes the difference in unified diff like format: '-' for the
+// old library, and '+' for the new one.
+func (this *LibraryDiff) WriteText(w io.Writer) error {
+	lines := []string{fmt.Sprintf("--- %s", this.Old), fmt.Sprintf("+++ %s", this.New)}
+	for _, arch := range this.RemovedArches {
+		lines = append(lines, fmt.Sprintf("-arch %s", arch))
+	}
+	for _, arch := range this.AddedArches {
+		lines = append(lines, fmt.Sprintf("+arch %s", arch))
+	}
+	for _, m := range this.Removed {
+		lines = append(lines, fmt.Sprintf("-member %s (%d bytes)", m.Name, m.Size))
+		lines = appendDiffLines(lines, "export", m.Exports, nil)
+		lines = appendDiffLines(lines, "import", m.Imports, nil)
+		lines = appendDiffLines(lines, "directive", m.Directives, nil)
+	}
+	for _, m := range this.Added {
+		lines = append(lines, fmt.Sprintf("+member %s (%d bytes)", m.Name, m.Size))
+		lines = appendDiffLines(lines, "export", nil, m.Exports)
+		lines = appendDiffLines(lines, "import", nil, m.Imports)
+		lines = appendDiffLines(lines, "directive", nil, m.Directives)
+	}
+	for _, m := range this.Changed {
+		lines = append(lines, fmt.Sprintf("~member %s (%d -> %d bytes)", m.Name, m.OldSize, m.NewSize))
+		if m.OldArch != m.NewArch {
+			lines = append(lines, fmt.Sprintf("  arch %s -> %s", m.OldArch, m.NewArch))
+		}
+		lines = appendDiffLines(lines, "export", m.RemovedExports, m.AddedExports)
+		lines = appendDiffLines(lines, "import", m.RemovedImports, m.AddedImports)
+		lines = appendDiffLines(lines, "directive", m.RemovedDirectives, m.AddedDirectives)
+	}
+	_, err := fmt.Fprintf(w, "%s\n", strings.Join(lines, "\n"))
+	return err
+}
+
+func appendDiffLines(lines []string, kind string, removed, added []string) []string {
+	for _, s := range removed {
+		lines = append(lines, fmt.Sprintf("  -%s %s", kind, s))
+	}
+	for _, s := range added {
+		lines = append(lines, fmt.Sprintf("  +%s %s", kind, s))
+	}
+	return lines
+}
@@ -0,0 +1,63 @@
+package catlib
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestDiffLibraries(t *testing.T) {
+	a := testObject{defines: []string{"f"}, imports: []string{"g"}, directives: "/DEFAULTLIB:libcmt"}.coff()
+	b := testObject{defines: []string{"h"}, directives: "/DEFAULTLIB:libcmt /INCLUDE:h"}.coff()
+	newA := testObject{defines: []string{"f"}, imports: []string{"g"}, directives: "/DEFAULTLIB:msvcrt"}.coff()
+	c := testObject{defines: []string{"k"}, directives: "/EXPORT:k"}.coff()
+	archive := func(members ...ArchiveMember) *Archive {
+		data, err := WriteArchive(members, ArchiveFormatCOFF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return openArchiveData(t, data)
+	}
+	oldLib := archive(ArchiveMember{"a.obj", a}, ArchiveMember{"b.obj", b})
+	defer oldLib.Close()
+	newLib := archive(ArchiveMember{"a.obj", newA}, ArchiveMember{"c.obj", c})
+	defer newLib.Close()
+
+	diff, err := DiffLibraries(oldLib, newLib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff.Old = "old.lib"
+	diff.New = "new.lib"
+	if diff.IsEmpty() {
+		t.Errorf("libraries are not different")
+	}
+	var buf bytes.Buffer
+	if err := diff.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf(`--- old.lib
++++ new.lib
+-member b.obj (%d bytes)
+  -export h
+  -directive /DEFAULTLIB:libcmt
+  -directive /INCLUDE:h
++member c.obj (%d bytes)
+  +export k
+  +directive /EXPORT:k
+~member a.obj (%d -> %d bytes)
+  -directive /DEFAULTLIB:libcmt
+  +directive /DEFAULTLIB:msvcrt
+`, len(b), len(c), len(a), len(newA))
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	same, err := DiffLibraries(oldLib, oldLib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same.IsEmpty() {
+		t.Errorf("same libraries are different")
+	}
+}
@@ -0,0 +1,155 @@
+package catlib
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DirectiveDefaultLib         = "DEFAULTLIB"
+	DirectiveInclude            = "INCLUDE"
+	DirectiveExport             = "EXPORT"
+	DirectiveFailIfMismatch     = "FAILIFMISMATCH"
+	DirectiveAlternateName      = "ALTERNATENAME"
+	DirectiveMerge              = "MERGE"
+	DirectiveManifestDependency = "MANIFESTDEPENDENCY"
+)
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// Directive is a linker option in '.drectve' section, such as
+// '/DEFAULTLIB:"libcmt"' or '-include:_foo'.
+type Directive struct {
+	// option name in upper case without the leading '/' or '-', one of
+	// Directive* constants or any other option. Empty for a token which is
+	// not an option, in which case Value holds the token as is.
+	Name string
+	// option argument with quotes removed. Empty when the option has no
+	// argument.
+	Value string
+}
+
+// ParseDirectives tokenizes contents of '.drectve' section. Tokens are
+// separated by white spaces (or NULs) outside of double quotes. The section
+// may start with UTF-8 BOM.
+func ParseDirectives(data []byte) []Directive {
+	ret := []Directive{}
+	for _, token := range directiveTokens(data) {
+		ret = append(ret, parseDirective(token))
+	}
+	return ret
+}
+
+// directiveTokens splits contents of '.drectve' section into tokens, which
+// have quotes as they are.
+func directiveTokens(data []byte) []string {
+	data = bytes.TrimPrefix(data, utf8BOM)
+
+	tokens := []string{}
+	token := []byte{}
+	quoted := false
+	for _, c := range data {
+		if !quoted && (c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == 0) {
+			if len(token) > 0 {
+				tokens = append(tokens, string(token))
+				token = []byte{}
+			}
+			continue
+		}
+		if c == '"' {
+			quoted = !quoted
+		}
+		token = append(token, c)
+	}
+	if len(token) > 0 {
+		tokens = append(tokens, string(token))
+	}
+	return tokens
+}
+
+func parseDirective(token string) Directive {
+	token = strings.Replace(token, "\"", "", -1)
+	if !strings.HasPrefix(token, "/") && !strings.HasPrefix(token, "-") {
+		return Directive{"", token}
+	}
+	name := token[1:]
+	value := ""
+	if i := strings.Index(name, ":"); i >= 0 {
+		value = name[i+1:]
+		name = name[:i]
+	}
+	return Directive{strings.ToUpper(name), value}
+}
+
+// String formats the directive as '/NAME:value', quoting the value if it
+// contains white spaces.
+func (this Directive) String() string {
+	if this.Name == "" {
+		return this.Value
+	}
+	if this.Value == "" {
+		return "/" + this.Name
+	}
+	value := this.Value
+	if strings.ContainsAny(value, " \t") {
+		value = "\"" + value + "\""
+	}
+	return "/" + this.Name + ":" + value
+}
+
+// FormatDirectives formats directives as contents of '.drectve' section.
+// UTF-8 BOM is prepended when any of them has non-ASCII characters.
+func FormatDirectives(directives []Directive) []byte {
+	return ReformatDirectives(nil, directives)
+}
+
+// ReformatDirectives formats directives as new contents of '.drectve'
+// section, which has data. Directives in data are written as they are, such
+// as '-defaultlib:"libcmt"' of mingw, and only changed or added ones are
+// formatted by String.
+func ReformatDirectives(data []byte, directives []Directive) []byte {
+	tokens := make(map[Directive][]string)
+	for _, token := range directiveTokens(data) {
+		d := parseDirective(token)
+		tokens[d] = append(tokens[d], token)
+	}
+	parts := []string{}
+	for _, d := range directives {
+		if t := tokens[d]; len(t) > 0 {
+			parts = append(parts, t[0])
+			tokens[d] = t[1:]
+		} else {
+			parts = append(parts, d.String())
+		}
+	}
+	s := " " + strings.Join(parts, " ") + " "
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return append(append([]byte{}, utf8BOM...), s...)
+		}
+	}
+	return []byte(s)
+}
+
+// DefaultLibName returns the name of a library used to match '/DEFAULTLIB'
+// directives with libraries: lower cased base name without extension.
+func DefaultLibName(filePath string) string {
+	name := strings.ToLower(filePath)
+	if i := strings.LastIndexAny(name, "/\\"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// ExportName returns the exported name of '/EXPORT' directive value, which
+// has the form 'entryname[=internalname][,@ordinal[,NONAME]][,DATA]'.
+func ExportName(value string) string {
+	if i := strings.Index(value, ","); i >= 0 {
+		value = value[:i]
+	}
+	if i := strings.Index(value, "="); i >= 0 {
+		value = value[:i]
+	}
+	return value
+}
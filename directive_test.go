@@ -0,0 +1,106 @@
+package catlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	tests := []struct {
+		data string
+		want []Directive
+	}{
+		{"", []Directive{}},
+		{`/DEFAULTLIB:"LIBCMT" /DEFAULTLIB:"OLDNAMES"`, []Directive{{"DEFAULTLIB", "LIBCMT"}, {"DEFAULTLIB", "OLDNAMES"}}},
+		// '-' prefix, and names in any case.
+		{"-defaultlib:zlib.lib /include:_foo", []Directive{{"DEFAULTLIB", "zlib.lib"}, {"INCLUDE", "_foo"}}},
+		// quoted values may have white spaces.
+		{`/DEFAULTLIB:"C:\x y\foo.lib"`, []Directive{{"DEFAULTLIB", `C:\x y\foo.lib`}}},
+		{`/FAILIFMISMATCH:"_MSC_VER=1900"`, []Directive{{"FAILIFMISMATCH", "_MSC_VER=1900"}}},
+		{`/MANIFESTDEPENDENCY:"type='win32' name='x'"`, []Directive{{"MANIFESTDEPENDENCY", "type='win32' name='x'"}}},
+		// UTF-8 BOM, and separators other than a space.
+		{"\xef\xbb\xbf /MERGE:.a=.b\t\r\n/NODEFAULTLIB\x00\x00", []Directive{{"MERGE", ".a=.b"}, {"NODEFAULTLIB", ""}}},
+		{"/EXPORT:f,DATA /EXPORT:g=_g,@1,NONAME", []Directive{{"EXPORT", "f,DATA"}, {"EXPORT", "g=_g,@1,NONAME"}}},
+		{"/ALTERNATENAME:a=b", []Directive{{"ALTERNATENAME", "a=b"}}},
+		// tokens which are not options.
+		{"bogus /INCLUDE:x", []Directive{{"", "bogus"}, {"INCLUDE", "x"}}},
+	}
+	for _, test := range tests {
+		got := ParseDirectives([]byte(test.data))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseDirectives(%q) = %q, want %q", test.data, got, test.want)
+		}
+	}
+}
+
+func TestFormatDirectives(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		// names are upper cased with '/' prefix, and quotes are dropped
+		// unless the value has white spaces.
+		{`-defaultlib:"libcmt" /include:_foo`, ` /DEFAULTLIB:libcmt /INCLUDE:_foo `},
+		{`/DEFAULTLIB:"C:\x y\foo.lib"`, ` /DEFAULTLIB:"C:\x y\foo.lib" `},
+		{"/EXPORT:f,DATA /ALTERNATENAME:a=b bogus", " /EXPORT:f,DATA /ALTERNATENAME:a=b bogus "},
+		// BOM is written only for non-ASCII values.
+		{"\xef\xbb\xbf/EXPORT:f", " /EXPORT:f "},
+		{"/EXPORT:\xc3\xa9", "\xef\xbb\xbf /EXPORT:\xc3\xa9 "},
+	}
+	for _, test := range tests {
+		got := string(FormatDirectives(ParseDirectives([]byte(test.data))))
+		if got != test.want {
+			t.Errorf("FormatDirectives(ParseDirectives(%q)) = %q, want %q", test.data, got, test.want)
+		}
+		// formatted directives parse to the same ones.
+		if again := ParseDirectives([]byte(got)); !reflect.DeepEqual(again, ParseDirectives([]byte(test.data))) {
+			t.Errorf("ParseDirectives(%q) = %q, which differs from the original", got, again)
+		}
+	}
+}
+
+// tokens which are not changed are written as they were.
+func TestReformatDirectives(t *testing.T) {
+	data := "\xef\xbb\xbf -defaultlib:\"libcmt\" -defaultlib:\"zlib\"\x00/include:_foo -export:f -EXPORT:f "
+	tests := []struct {
+		name   string
+		change func(directives []Directive) []Directive
+		want   string
+	}{
+		{"unchanged", func(directives []Directive) []Directive {
+			return directives
+		}, ` -defaultlib:"libcmt" -defaultlib:"zlib" /include:_foo -export:f -EXPORT:f `},
+		{"removed", func(directives []Directive) []Directive {
+			return append(directives[:1], directives[2:]...)
+		}, ` -defaultlib:"libcmt" /include:_foo -export:f -EXPORT:f `},
+		{"changed", func(directives []Directive) []Directive {
+			directives[1].Value = "z"
+			return directives
+		}, ` -defaultlib:"libcmt" /DEFAULTLIB:z /include:_foo -export:f -EXPORT:f `},
+		{"added", func(directives []Directive) []Directive {
+			return append(directives, Directive{DirectiveInclude, "_bar"}, Directive{DirectiveExport, "f"})
+		}, ` -defaultlib:"libcmt" -defaultlib:"zlib" /include:_foo -export:f -EXPORT:f /INCLUDE:_bar /EXPORT:f `},
+		{"reordered", func(directives []Directive) []Directive {
+			return []Directive{directives[2], directives[0]}
+		}, ` /include:_foo -defaultlib:"libcmt" `},
+	}
+	for _, test := range tests {
+		directives := test.change(ParseDirectives([]byte(data)))
+		if got := string(ReformatDirectives([]byte(data), directives)); got != test.want {
+			t.Errorf("%s: %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExportName(t *testing.T) {
+	tests := map[string]string{
+		"f":              "f",
+		"f,DATA":         "f",
+		"g=_g,@1,NONAME": "g",
+	}
+	for value, want := range tests {
+		if got := ExportName(value); got != want {
+			t.Errorf("ExportName(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package catlib
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	elfSHT_SYMTAB = 2
+	elfSTB_GLOBAL = 1
+	elfSTB_WEAK   = 2
+)
+
+type elfHeader struct {
+	is64      bool
+	order     binary.ByteOrder
+	shoff     int
+	shentsize int
+	shnum     int
+}
+
+func readELFHeader(data []byte) (elfHeader, error) {
+	var h elfHeader
+	if len(data) < 0x34 {
+		return h, fmt.Errorf("too short for ELF header")
+	}
+	h.is64 = data[4] == 2
+	h.order = binary.LittleEndian
+	if data[5] == 2 {
+		h.order = binary.BigEndian
+	}
+
+	if h.is64 {
+		if len(data) < 0x40 {
+			return h, fmt.Errorf("too short for ELF header")
+		}
+		h.shoff = int(h.order.Uint64(data[0x28:]))
+		h.shentsize = int(h.order.Uint16(data[0x3a:]))
+		h.shnum = int(h.order.Uint16(data[0x3c:]))
+	} else {
+		h.shoff = int(h.order.Uint32(data[0x20:]))
+		h.shentsize = int(h.order.Uint16(data[0x2e:]))
+		h.shnum = int(h.order.Uint16(data[0x30:]))
+	}
+	if h.shoff+h.shentsize*h.shnum > len(data) {
+		return h, fmt.Errorf("section header table out of range")
+	}
+	return h, nil
+}
+
+// section returns i-th section header.
+func (this elfHeader) section(data []byte, i int) []byte {
+	return data[this.shoff+i*this.shentsize : this.shoff+(i+1)*this.shentsize]
+}
+
+// sectionRange returns sh_offset and sh_size of the section header.
+func (this elfHeader) sectionRange(sh []byte) (int, int) {
+	if this.is64 {
+		return int(this.order.Uint64(sh[24:])), int(this.order.Uint64(sh[32:]))
+	}
+	return int(this.order.Uint32(sh[16:])), int(this.order.Uint32(sh[20:]))
+}
+
+func (this elfHeader) setSectionRange(sh []byte, offset, size int) {
+	if this.is64 {
+		this.order.PutUint64(sh[24:], uint64(offset))
+		this.order.PutUint64(sh[32:], uint64(size))
+	} else {
+		this.order.PutUint32(sh[16:], uint32(offset))
+		this.order.PutUint32(sh[20:], uint32(size))
+	}
+}
+
+func (this elfHeader) sectionLink(sh []byte) int {
+	if this.is64 {
+		return int(this.order.Uint32(sh[40:]))
+	}
+	return int(this.order.Uint32(sh[24:]))
+}
+
+func renameELFSymbols(data []byte, names map[string]string) ([]byte, error) {
+	h, err := readELFHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	is64 := h.is64
+	order := h.order
+	shoff := h.shoff
+	shentsize := h.shentsize
+	shnum := h.shnum
+
+	ret := append([]byte{}, data...)
+	changed := false
+
+	for i := 0; i < shnum; i++ {
+		sh := h.section(data, i)
+		if order.Uint32(sh[4:]) != elfSHT_SYMTAB {
+			continue
+		}
+		symtabOffset, symtabSize := h.sectionRange(sh)
+		link := h.sectionLink(sh)
+		if link >= shnum {
+			return nil, fmt.Errorf("invalid string table index %d", link)
+		}
+		strtabHeaderOffset := shoff + link*shentsize
+		strtabOffset, strtabSize := h.sectionRange(h.section(data, link))
+		if symtabOffset+symtabSize > len(data) || strtabOffset+strtabSize > len(data) {
+			return nil, fmt.Errorf("symbol table out of range")
+		}
+		strtab := newStringTableBuilder(data[strtabOffset : strtabOffset+strtabSize])
+
+		symSize := 16
+		if is64 {
+			symSize = 24
+		}
+		tableChanged := false
+		for offset := symtabOffset; offset+symSize <= symtabOffset+symtabSize; offset += symSize {
+			var info byte
+			if is64 {
+				info = ret[offset+4]
+			} else {
+				info = ret[offset+12]
+			}
+			binding := info >> 4
+			if binding != elfSTB_GLOBAL && binding != elfSTB_WEAK {
+				continue
+			}
+			name, err := cString(strtab.table, int(order.Uint32(ret[offset:])))
+			if err != nil {
+				return nil, err
+			}
+			newName, ok := names[name]
+			if !ok || newName == name {
+				continue
+			}
+			order.PutUint32(ret[offset:], uint32(strtab.add(newName)))
+			tableChanged = true
+		}
+		if !tableChanged {
+			continue
+		}
+
+		// move the grown string table to the end of file. The old one is left
+		// as is, because it might be shared with section names.
+		newOffset := len(ret)
+		ret = append(ret, strtab.table...)
+		strtabHeader := ret[strtabHeaderOffset : strtabHeaderOffset+shentsize]
+		h.setSectionRange(strtabHeader, newOffset, len(strtab.table))
+		changed = true
+	}
+
+	if !changed {
+		return nil, nil
+	}
+	return ret, nil
+}
@@ -0,0 +1,99 @@
+package catlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+type graphNode struct {
+	ID      int    `json:"id"`
+	Library string `json:"library"`
+	Member  string `json:"member"`
+	Base    bool   `json:"base"`
+}
+
+type graphEdge struct {
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Symbols []string `json:"symbols"`
+}
+
+type graph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+func (this *Plan) graph() graph {
+	var g graph
+	ids := make(map[*PlanMember]int)
+	for i, member := range this.Members() {
+		ids[member] = i
+		g.Nodes = append(g.Nodes, graphNode{i, member.Library, member.Name, member.IsBase()})
+	}
+	g.Edges = []graphEdge{}
+	for _, edge := range this.Edges {
+		g.Edges = append(g.Edges, graphEdge{ids[edge.From], ids[edge.To], edge.Symbols})
+	}
+	return g
+}
+
+// WriteGraphJSON writes the member dependency graph in JSON. Nodes are base
+// and pulled members, and edges are labeled with the referenced symbols.
+func (this *Plan) WriteGraphJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(this.graph(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// WriteGraphDot writes the member dependency graph in Graphviz DOT format.
+// Members are grouped into clusters by their source library.
+func (this *Plan) WriteGraphDot(w io.Writer) error {
+	g := this.graph()
+
+	libraries := []string{}
+	nodes := make(map[string][]graphNode)
+	for _, node := range g.Nodes {
+		if _, ok := nodes[node.Library]; !ok {
+			libraries = append(libraries, node.Library)
+		}
+		nodes[node.Library] = append(nodes[node.Library], node)
+	}
+
+	lines := []string{"digraph catlib {", "  node [shape=box];"}
+	for i, library := range libraries {
+		lines = append(lines, fmt.Sprintf("  subgraph cluster_%d {", i))
+		lines = append(lines, fmt.Sprintf("    label=%s;", dotQuote(filepath.Base(library))))
+		for _, node := range nodes[library] {
+			style := ""
+			if node.Base {
+				style = " style=bold"
+			}
+			lines = append(lines, fmt.Sprintf("    n%d [label=%s%s];", node.ID, dotQuote(node.Member), style))
+		}
+		lines = append(lines, "  }")
+	}
+	for _, edge := range g.Edges {
+		lines = append(lines, fmt.Sprintf("  n%d -> n%d [label=%s];", edge.From, edge.To, dotQuote(strings.Join(edge.Symbols, "\n"))))
+	}
+	lines = append(lines, "}")
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	s = strings.Replace(s, "\n", "\\n", -1)
+	return "\"" + s + "\""
+}
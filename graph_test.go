@@ -0,0 +1,98 @@
+package catlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// testPlan returns a plan where base.o pulls 'z:inflate.o', which pulls
+// 'z:zutil.o'.
+func testPlan() *Plan {
+	base := &PlanMember{Library: "/work/base.lib", Name: "base.o", Exports: []string{"main"}, Imports: []string{"inflate"}, base: true}
+	inflate := &PlanMember{Library: "/work/z.lib", Name: "inflate.o", Reason: PullReasonSymbol, Symbols: []string{"inflate"}, Exports: []string{"inflate"}, Imports: []string{"zcalloc", "zcfree"}}
+	zutil := &PlanMember{Library: "/work/z.lib", Name: "zutil.o", Reason: PullReasonSymbol, Symbols: []string{"zcalloc", "zcfree"}, Exports: []string{"zcalloc", "zcfree"}}
+	plan := &Plan{Base: []*PlanMember{base}, Pulled: []*PlanMember{inflate, zutil}, Unresolved: []string{"malloc"}}
+	plan.Edges = []*PlanEdge{
+		{From: base, To: inflate, Symbols: []string{"inflate"}},
+		{From: inflate, To: zutil, Symbols: []string{"zcalloc", "zcfree"}},
+	}
+	return plan
+}
+
+func TestWriteGraphDot(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testPlan().WriteGraphDot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph catlib {
+  node [shape=box];
+  subgraph cluster_0 {
+    label="base.lib";
+    n0 [label="base.o" style=bold];
+  }
+  subgraph cluster_1 {
+    label="z.lib";
+    n1 [label="inflate.o"];
+    n2 [label="zutil.o"];
+  }
+  n0 -> n1 [label="inflate"];
+  n1 -> n2 [label="zcalloc\nzcfree"];
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteGraphJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testPlan().WriteGraphJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got graph
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := graph{
+		Nodes: []graphNode{
+			{0, "/work/base.lib", "base.o", true},
+			{1, "/work/z.lib", "inflate.o", false},
+			{2, "/work/z.lib", "zutil.o", false},
+		},
+		Edges: []graphEdge{
+			{0, 1, []string{"inflate"}},
+			{1, 2, []string{"zcalloc", "zcfree"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%+v, want %+v", got, want)
+	}
+}
+
+func TestDotQuote(t *testing.T) {
+	if got, want := dotQuote("a\"b\\c\nd"), `"a\"b\\c\nd"`; got != want {
+		t.Errorf("%s, want %s", got, want)
+	}
+}
+
+// edges of resolved plans are labeled with the symbols resolved by them.
+func TestResolveEdges(t *testing.T) {
+	plan := resolveTestLibraries(t, ResolverOptions{Semantics: SemanticsMSVC},
+		[]testMember{{"base.o", testObject{imports: []string{"inflate"}}}},
+		testLibrary{"z.lib", []testMember{
+			{"inflate.o", testObject{defines: []string{"inflate"}, imports: []string{"zcalloc", "zcfree"}}},
+			{"zutil.o", testObject{defines: []string{"zcalloc", "zcfree"}}},
+		}})
+	got := []string{}
+	for _, edge := range plan.Edges {
+		got = append(got, edge.From.Label()+" -> "+edge.To.Label())
+		if edge.To.Name == "zutil.o" && !reflect.DeepEqual(edge.Symbols, []string{"zcalloc", "zcfree"}) {
+			t.Errorf("symbols %q", edge.Symbols)
+		}
+	}
+	if want := []string{"base.o -> z:inflate.o", "z:inflate.o -> z:zutil.o"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("%q, want %q", got, want)
+	}
+}
@@ -0,0 +1,30 @@
+package catlib
+
+var (
+	initializerSectionPrefixes = []string{
+		// MSVC C++ and C initializers, and TLS callbacks.
+		".CRT$XC", ".CRT$XI", ".CRT$XL",
+		// ELF
+		".init_array", ".preinit_array", ".ctors",
+	}
+	initializerSectionNames = []string{
+		// Mach-O
+		"__mod_init_func", "__init_offsets",
+	}
+)
+
+// IsInitializerSection returns true when the section holds static
+// initializers (or TLS callbacks), which are run without being referenced.
+func IsInitializerSection(name string) bool {
+	return hasAnyPrefix(name, initializerSectionPrefixes) || contains(initializerSectionNames, name)
+}
+
+// HasInitializer returns true when any of sections holds static initializers.
+func HasInitializer(sections []string) bool {
+	for _, section := range sections {
+		if IsInitializerSection(section) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package catlib
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// testInitializerSection is the section of static initializers in the format
+// of testObject.bytes.
+func testInitializerSection() string {
+	if runtime.GOOS == "darwin" {
+		return "__mod_init_func"
+	}
+	return ".CRT$XCU"
+}
+
+func TestIsInitializerSection(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{".CRT$XCU", true},
+		{".CRT$XIC", true},
+		{".CRT$XLB", true},
+		{".CRT$XPA", false},
+		{".init_array", true},
+		{".init_array.00100", true},
+		{".ctors", true},
+		{"__mod_init_func", true},
+		{"__init_offsets", true},
+		{"__mod_term_func", false},
+		{".text", false},
+	}
+	for _, test := range tests {
+		if got := IsInitializerSection(test.name); got != test.want {
+			t.Errorf("%s: %v", test.name, got)
+		}
+	}
+	if HasInitializer([]string{".text", ".data"}) || !HasInitializer([]string{".text", ".CRT$XCU"}) {
+		t.Errorf("HasInitializer is wrong")
+	}
+}
+
+// members which have static initializers but no exported symbols can not be
+// pulled by symbols. they are pulled with IncludeInitializers, or dropped.
+func TestResolveInitializers(t *testing.T) {
+	initializer := []string{testInitializerSection()}
+	base := []testMember{
+		{"base.o", testObject{imports: []string{"f"}}},
+		// base members are kept, even if they have no symbols.
+		{"init.o", testObject{sections: initializer}},
+	}
+	input := testLibrary{"a.lib", []testMember{
+		{"f.o", testObject{defines: []string{"f"}}},
+		{"ctor.o", testObject{imports: []string{"h"}, sections: initializer}},
+		{"h.o", testObject{defines: []string{"h"}}},
+		{"g.o", testObject{defines: []string{"g"}, sections: initializer}},
+	}}
+	tests := []struct {
+		includeInitializers bool
+		pulled              []string
+		dropped             []string
+	}{
+		{false, []string{"a:f.o symbol"}, []string{"a:ctor.o"}},
+		{true, []string{"a:ctor.o initializer", "a:f.o symbol", "a:h.o symbol"}, []string{}},
+	}
+	for _, test := range tests {
+		for _, semantics := range allSemantics {
+			plan := resolveTestLibraries(t, ResolverOptions{Semantics: semantics, IncludeInitializers: test.includeInitializers}, base, input)
+			if got := memberLabels(plan.Base); !reflect.DeepEqual(got, []string{"base.o", "init.o"}) {
+				t.Errorf("%s: base %q", semantics, got)
+			}
+			if got := pullReasons(plan); !reflect.DeepEqual(got, test.pulled) {
+				t.Errorf("%s %v: pulled %q, want %q", semantics, test.includeInitializers, got, test.pulled)
+			}
+			if got := memberLabels(plan.DroppedInitializers); !reflect.DeepEqual(got, test.dropped) {
+				t.Errorf("%s %v: dropped %q, want %q", semantics, test.includeInitializers, got, test.dropped)
+			}
+		}
+	}
+}
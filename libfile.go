@@ -6,9 +6,15 @@ import (
 
 type ILibFile interface {
 	Open(filePath string, arch string) error
+	// opens an object file as a library which has single member.
+	OpenObject(filePath string, arch string) error
 	Close()
 	NumMembers() int
+	MemberName(memberIndex int) string
+	MemberSize(memberIndex int) int64
 	Extract(memberIndex int, w io.Writer) error
 	ImportSymbols(memberIndex int) []ISymbol
 	ExportSymbols(memberIndex int) []ISymbol
+	Sections(memberIndex int) []string
+	Directives(memberIndex int) []Directive
 }
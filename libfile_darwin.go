@@ -2,6 +2,7 @@ package catlib
 
 import (
 	"bufio"
+	"debug/macho"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -22,6 +23,7 @@ type LibFile struct {
 type libMember struct {
 	ImportSymbols []Symbol
 	ExportSymbols []Symbol
+	Sections      []string
 	Name          string
 }
 
@@ -42,7 +44,45 @@ func (this *LibFile) Open(filePath string, arch string) (err error) {
 	}
 
 	err = extractAllMembers(this.extractedFilePath, this.tempDir)
+	if err != nil {
+		return err
+	}
+
+	return this.readMembers(filePath, arch, nil)
+}
+
+// OpenObject opens an object file as a library which has single member.
+func (this *LibFile) OpenObject(filePath string, arch string) (err error) {
+	this.filePath = filePath
+	this.tempDir, err = ioutil.TempDir(TempDir(), "lib")
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(filePath)
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(filepath.Join(this.tempDir, name))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	dst.Close()
+	if err != nil {
+		return err
+	}
+
+	current := new(libMember)
+	current.Name = name
+	return this.readMembers(filePath, arch, current)
+}
 
+// readMembers reads symbols of members with nm. current is the member which
+// symbols belong to until nm reports another member.
+func (this *LibFile) readMembers(filePath string, arch string, current *libMember) error {
 	regObjectName := regexp.MustCompile(`^.*\((.*)\):$`)
 	regExportFunction := regexp.MustCompile(`^([0-9A-Za-z]+)?\s+(T|U|S|D|t|s|d)\s+(.*)$`)
 	cmd := exec.Command("nm", "-arch", arch, filePath)
@@ -52,7 +92,6 @@ func (this *LibFile) Open(filePath string, arch string) (err error) {
 	}
 	cmd.Start()
 	s := bufio.NewScanner(stdout)
-	var current *libMember = nil
 	for s.Scan() {
 		line := []byte(s.Text())
 		if len(line) == 0 {
@@ -87,7 +126,8 @@ func (this *LibFile) Open(filePath string, arch string) (err error) {
 		this.members = append(this.members, *current)
 	}
 
-	for _, m := range this.members {
+	for i := range this.members {
+		m := &this.members[i]
 		actuallyImported := []Symbol{}
 		for _, im := range m.ImportSymbols {
 			found := false
@@ -104,6 +144,29 @@ func (this *LibFile) Open(filePath string, arch string) (err error) {
 		m.ImportSymbols = actuallyImported
 	}
 
+	for i := range this.members {
+		m := &this.members[i]
+		obj, e := macho.Open(filepath.Join(this.tempDir, m.Name))
+		if e != nil {
+			continue
+		}
+		for _, section := range obj.Sections {
+			m.Sections = append(m.Sections, section.Name)
+		}
+		if obj.Symtab != nil {
+			weak := NewStringSet()
+			for _, sym := range obj.Symtab.Syms {
+				if sym.Type&machoN_EXT != 0 && sym.Desc&machoN_WEAK_DEF != 0 {
+					weak.Put(sym.Name)
+				}
+			}
+			for j := range m.ExportSymbols {
+				m.ExportSymbols[j].weak = weak.Has(m.ExportSymbols[j].Name())
+			}
+		}
+		obj.Close()
+	}
+
 	return nil
 }
 
@@ -127,6 +190,18 @@ func (this *LibFile) NumMembers() int {
 	return len(this.members)
 }
 
+func (this *LibFile) MemberName(memberIndex int) string {
+	return this.members[memberIndex].Name
+}
+
+func (this *LibFile) MemberSize(memberIndex int) int64 {
+	info, err := os.Stat(filepath.Join(this.tempDir, this.members[memberIndex].Name))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
 func (this *LibFile) Extract(memberIndex int, w io.Writer) error {
 	memberName := this.members[memberIndex].Name
 	srcPath := filepath.Join(this.tempDir, memberName)
@@ -150,6 +225,16 @@ func (this *LibFile) ExportSymbols(memberIndex int) []Symbol {
 	return this.members[memberIndex].ExportSymbols
 }
 
+func (this *LibFile) Sections(memberIndex int) []string {
+	return this.members[memberIndex].Sections
+}
+
+// Directives returns linker directives of the member. Mach-O objects have no
+// '.drectve' section, so the result is always empty.
+func (this *LibFile) Directives(memberIndex int) []Directive {
+	return []Directive{}
+}
+
 func Concat(files []string, output, workingDirectory, arch, libflags string) error {
 	filelist, err := ioutil.TempFile(TempDir(), "libtool")
 	if err != nil {
@@ -176,11 +261,49 @@ func Concat(files []string, output, workingDirectory, arch, libflags string) err
 	return err
 }
 
+// Prelink links object files into single relocatable object with 'ld -r'.
+// Global symbols not listed in exportedSymbols are turned into local ones.
+func Prelink(files []string, output, workingDirectory, arch string, exportedSymbols []string) error {
+	filelist, err := ioutil.TempFile(TempDir(), "ld")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Fprintf(filelist, "%s\n", f)
+	}
+	filelist.Close()
+	defer os.Remove(filelist.Name())
+
+	symbols, err := ioutil.TempFile(TempDir(), "exported")
+	if err != nil {
+		return err
+	}
+	for _, s := range exportedSymbols {
+		fmt.Fprintf(symbols, "%s\n", s)
+	}
+	symbols.Close()
+	defer os.Remove(symbols.Name())
+
+	cmd := exec.Command("ld")
+	cmd.Args = append(cmd.Args, "-r")
+	cmd.Args = append(cmd.Args, "-arch")
+	cmd.Args = append(cmd.Args, arch)
+	cmd.Args = append(cmd.Args, "-exported_symbols_list")
+	cmd.Args = append(cmd.Args, symbols.Name())
+	cmd.Args = append(cmd.Args, "-filelist")
+	cmd.Args = append(cmd.Args, filelist.Name())
+	cmd.Args = append(cmd.Args, "-o")
+	cmd.Args = append(cmd.Args, output)
+	cmd.Dir = workingDirectory
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
 func extractFatBinary(inFilePath string, outFilePath string, arch string) error {
 	cmd := exec.Command("libtool", "-static", "-arch_only", arch, inFilePath, "-o", outFilePath)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, string(output))
+		fmt.Fprint(os.Stderr, string(output))
 		return err
 	}
 	return nil
@@ -0,0 +1,39 @@
+package catlib
+
+import (
+	"debug/macho"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// symbols not exported are made local by 'ld -r', so only '_f' is visible
+// outside of the prelinked object.
+func TestPrelink(t *testing.T) {
+	if _, err := exec.LookPath("ld"); err != nil {
+		t.Skip("ld is not available")
+	}
+	dir := t.TempDir()
+	files := []string{
+		writeTestObject(t, dir, "a.o", testObject{defines: []string{"_f", "_g"}}),
+		writeTestObject(t, dir, "b.o", testObject{defines: []string{"_h"}, imports: []string{"_g"}}),
+	}
+	output := filepath.Join(dir, "prelinked.o")
+	if err := Prelink(files, output, dir, "x86_64", []string{"_f"}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := macho.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	global := []string{}
+	for _, sym := range f.Symtab.Syms {
+		if sym.Type&machoN_EXT != 0 && sym.Type&machoN_PEXT == 0 {
+			global = append(global, sym.Name)
+		}
+	}
+	if len(global) != 1 || global[0] != "_f" {
+		t.Errorf("global symbols %q, want [\"_f\"]", global)
+	}
+}
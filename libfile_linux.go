@@ -0,0 +1,88 @@
+package catlib
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// LibFile reads libraries with Archive, as there are no host tools the
+// other backends depend on.
+type LibFile struct {
+	ILibFile
+	archive Archive
+}
+
+func (this *LibFile) Open(filePath string, arch string) error {
+	return this.archive.Open(filePath, arch)
+}
+
+// OpenObject opens an object file as a library which has single member.
+func (this *LibFile) OpenObject(filePath string, arch string) error {
+	return this.archive.OpenObject(filePath, arch)
+}
+
+func (this *LibFile) Close() {
+	this.archive.Close()
+}
+
+func (this *LibFile) NumMembers() int {
+	return this.archive.NumMembers()
+}
+
+func (this *LibFile) MemberName(memberIndex int) string {
+	return this.archive.MemberName(memberIndex)
+}
+
+func (this *LibFile) MemberSize(memberIndex int) int64 {
+	return this.archive.MemberSize(memberIndex)
+}
+
+func (this *LibFile) Extract(memberIndex int, w io.Writer) error {
+	return this.archive.Extract(memberIndex, w)
+}
+
+func (this *LibFile) ImportSymbols(memberIndex int) []Symbol {
+	return newSymbols(this.archive.ImportSymbols(memberIndex))
+}
+
+func (this *LibFile) ExportSymbols(memberIndex int) []Symbol {
+	return newSymbols(this.archive.ExportSymbols(memberIndex))
+}
+
+func (this *LibFile) Sections(memberIndex int) []string {
+	return this.archive.Sections(memberIndex)
+}
+
+func (this *LibFile) Directives(memberIndex int) []Directive {
+	return this.archive.Directives(memberIndex)
+}
+
+func newSymbols(symbols []ISymbol) []Symbol {
+	ret := []Symbol{}
+	for _, sym := range symbols {
+		s := NewSymbol(sym.Name(), sym.IsImportSymbol())
+		s.weak = sym.IsWeak()
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// Concat writes the files into a static library with PackFiles.
+func Concat(files []string, output, workingDirectory, arch, libflags string) error {
+	if libflags != "" {
+		return fmt.Errorf("extra lib flags are not supported on Linux")
+	}
+	paths := []string{}
+	for _, file := range files {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(workingDirectory, file)
+		}
+		paths = append(paths, file)
+	}
+	return PackFiles(output, paths, "")
+}
+
+func Prelink(files []string, output, workingDirectory, arch string, exportedSymbols []string) error {
+	return fmt.Errorf("prelinking is not supported on Linux")
+}
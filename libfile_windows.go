@@ -35,6 +35,8 @@ type MemberHeader struct {
 	LongName   string
 	fileOffset int64
 	symbols    []Symbol
+	sections   []string
+	directives []Directive
 }
 
 type LibFile struct {
@@ -55,37 +57,6 @@ type tagSecondLinkerMember struct {
 	StringTable     []string
 }
 
-const (
-	IMAGE_SYM_CLASS_END_OF_FUNCTION  = 0x00ff
-	IMAGE_SYM_CLASS_NULL             = 0x0000
-	IMAGE_SYM_CLASS_AUTOMATIC        = 0x0001
-	IMAGE_SYM_CLASS_EXTERNAL         = 0x0002
-	IMAGE_SYM_CLASS_STATIC           = 0x0003
-	IMAGE_SYM_CLASS_REGISTER         = 0x0004
-	IMAGE_SYM_CLASS_EXTERNAL_DEF     = 0x0005
-	IMAGE_SYM_CLASS_LABEL            = 0x0006
-	IMAGE_SYM_CLASS_UNDEFINED_LABEL  = 0x0007
-	IMAGE_SYM_CLASS_MEMBER_OF_STRUCT = 0x0008
-	IMAGE_SYM_CLASS_ARGUMENT         = 0x0009
-	IMAGE_SYM_CLASS_STRUCT_TAG       = 0x000A
-	IMAGE_SYM_CLASS_MEMBER_OF_UNION  = 0x000B
-	IMAGE_SYM_CLASS_UNION_TAG        = 0x000C
-	IMAGE_SYM_CLASS_TYPE_DEFINITION  = 0x000D
-	IMAGE_SYM_CLASS_UNDEFINED_STATIC = 0x000E
-	IMAGE_SYM_CLASS_ENUM_TAG         = 0x000F
-	IMAGE_SYM_CLASS_MEMBER_OF_ENUM   = 0x0010
-	IMAGE_SYM_CLASS_REGISTER_PARAM   = 0x0011
-	IMAGE_SYM_CLASS_BIT_FIELD        = 0x0012
-	IMAGE_SYM_CLASS_FAR_EXTERNAL     = 0x0044
-	IMAGE_SYM_CLASS_BLOCK            = 0x0064
-	IMAGE_SYM_CLASS_FUNCTION         = 0x0065
-	IMAGE_SYM_CLASS_END_OF_STRUCT    = 0x0066
-	IMAGE_SYM_CLASS_FILE             = 0x0067
-	IMAGE_SYM_CLASS_SECTION          = 0x0068
-	IMAGE_SYM_CLASS_WEAK_EXTERNAL    = 0x0069
-	IMAGE_SYM_CLASS_CLR_TOKEN        = 0x006B
-)
-
 var (
 	lib = ""
 )
@@ -143,10 +114,26 @@ func (lib *LibFile) ExportSymbols(memberIndex int) []Symbol {
 	return ret
 }
 
+func (this *LibFile) Sections(memberIndex int) []string {
+	return this.Members[memberIndex].sections
+}
+
+func (this *LibFile) Directives(memberIndex int) []Directive {
+	return this.Members[memberIndex].directives
+}
+
 func (this *LibFile) NumMembers() int {
 	return len(this.Members)
 }
 
+func (this *LibFile) MemberName(memberIndex int) string {
+	return this.Members[memberIndex].Name()
+}
+
+func (this *LibFile) MemberSize(memberIndex int) int64 {
+	return int64(this.Members[memberIndex].Size)
+}
+
 func (h IMAGE_ARCHIVE_MEMBER_HEADER) name() string {
 	return string(h.RawName[:len(h.RawName)])
 }
@@ -348,9 +335,7 @@ func (lib *LibFile) Open(filePath string, arch string) error {
 		if e1 != nil {
 			continue
 		}
-		for _, sym := range obj.Symbols {
-			m.symbols = append(m.symbols, NewSymbol(sym))
-		}
+		m.readObject(obj)
 
 		lib.Members = append(lib.Members, m)
 	}
@@ -358,6 +343,68 @@ func (lib *LibFile) Open(filePath string, arch string) error {
 	return nil
 }
 
+// OpenObject opens an object file as a library which has single member.
+func (lib *LibFile) OpenObject(filePath string, arch string) error {
+	lib.filePath = filePath
+	obj, err := pe.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	m := new(MemberHeader)
+	m.LongName = filepath.Base(filePath)
+	m.Size = int(info.Size())
+	m.readObject(obj)
+	lib.Members = append(lib.Members, m)
+	return nil
+}
+
+func (m *MemberHeader) readObject(obj *pe.File) {
+	weakDefinitions := readWeakDefinitions(obj)
+	for i, sym := range obj.Symbols {
+		s := NewSymbol(sym)
+		if sym.SectionNumber > 0 && int(sym.SectionNumber) <= len(obj.Sections) {
+			s.comdat = obj.Sections[sym.SectionNumber-1].Characteristics&IMAGE_SCN_LNK_COMDAT != 0
+		}
+		s.weakDefinition = weakDefinitions[i]
+		m.symbols = append(m.symbols, s)
+	}
+	for _, section := range obj.Sections {
+		m.sections = append(m.sections, section.Name)
+	}
+	if section := obj.Section(".drectve"); section != nil {
+		if data, err := section.Data(); err == nil {
+			m.directives = ParseDirectives(data)
+		}
+	}
+}
+
+// readWeakDefinitions returns indices in obj.Symbols of weak externals,
+// whose default symbols are defined in the object.
+func readWeakDefinitions(obj *pe.File) map[int]bool {
+	ret := make(map[int]bool)
+	index := 0
+	for i := 0; i < len(obj.COFFSymbols); i++ {
+		sym := obj.COFFSymbols[i]
+		if sym.StorageClass == IMAGE_SYM_CLASS_WEAK_EXTERNAL && sym.NumberOfAuxSymbols > 0 && i+1 < len(obj.COFFSymbols) {
+			// the first field of the aux record is the index of the default
+			// symbol.
+			tag := int(binary.LittleEndian.Uint32(obj.COFFSymbols[i+1].Name[0:4]))
+			if tag < len(obj.COFFSymbols) && obj.COFFSymbols[tag].SectionNumber > 0 {
+				ret[index] = true
+			}
+		}
+		i += int(sym.NumberOfAuxSymbols)
+		index++
+	}
+	return ret
+}
+
 func (this *LibFile) Close() {
 }
 
@@ -466,3 +513,7 @@ func Concat(files []string, output, workingDirectory, arch string, libflags stri
 	}
 	return nil
 }
+
+func Prelink(files []string, output, workingDirectory, arch string, exportedSymbols []string) error {
+	return fmt.Errorf("prelinking is not supported on Windows")
+}
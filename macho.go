@@ -0,0 +1,144 @@
+package catlib
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	machoMagic32   = 0xfeedface
+	machoMagic64   = 0xfeedfacf
+	machoLC_SYMTAB = 0x2
+	machoN_STAB    = 0xe0
+	machoN_PEXT    = 0x10
+	machoN_EXT     = 0x01
+	machoN_TYPE    = 0x0e
+	machoN_UNDF    = 0x00
+	machoN_ABS     = 0x02
+	machoN_INDR    = 0x0a
+	machoN_SECT    = 0x0e
+	// n_desc flags of weak references and weak definitions.
+	machoN_WEAK_REF = 0x0040
+	machoN_WEAK_DEF = 0x0080
+)
+
+func isMachO(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	le := binary.LittleEndian.Uint32(data)
+	be := binary.BigEndian.Uint32(data)
+	return le == machoMagic32 || le == machoMagic64 || be == machoMagic32 || be == machoMagic64
+}
+
+type machoHeader struct {
+	order      binary.ByteOrder
+	is64       bool
+	ncmds      int
+	sizeofcmds int
+	headerSize int
+}
+
+func readMachOHeader(data []byte) (machoHeader, error) {
+	var h machoHeader
+	if len(data) < 28 {
+		return h, fmt.Errorf("too short for Mach-O header")
+	}
+	h.order = binary.LittleEndian
+	magic := h.order.Uint32(data)
+	if magic != machoMagic32 && magic != machoMagic64 {
+		h.order = binary.BigEndian
+		magic = h.order.Uint32(data)
+	}
+	h.is64 = magic == machoMagic64
+	h.ncmds = int(h.order.Uint32(data[16:]))
+	h.sizeofcmds = int(h.order.Uint32(data[20:]))
+	h.headerSize = 28
+	if h.is64 {
+		h.headerSize = 32
+	}
+	if h.headerSize+h.sizeofcmds > len(data) {
+		return h, fmt.Errorf("load commands out of range")
+	}
+	return h, nil
+}
+
+func renameMachOSymbols(data []byte, names map[string]string) ([]byte, error) {
+	h, err := readMachOHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	order := h.order
+
+	ret := append([]byte{}, data...)
+	offset := h.headerSize
+	for i := 0; i < h.ncmds; i++ {
+		if offset+8 > len(ret) {
+			return nil, fmt.Errorf("load command out of range")
+		}
+		cmd := order.Uint32(ret[offset:])
+		cmdsize := int(order.Uint32(ret[offset+4:]))
+		if cmdsize < 8 {
+			return nil, fmt.Errorf("invalid load command size %d", cmdsize)
+		}
+		if cmd != machoLC_SYMTAB {
+			offset += cmdsize
+			continue
+		}
+
+		symoff := int(order.Uint32(ret[offset+8:]))
+		nsyms := int(order.Uint32(ret[offset+12:]))
+		stroff := int(order.Uint32(ret[offset+16:]))
+		strsize := int(order.Uint32(ret[offset+20:]))
+		nlistSize := 12
+		if h.is64 {
+			nlistSize = 16
+		}
+		if symoff+nsyms*nlistSize > len(ret) || stroff+strsize > len(ret) {
+			return nil, fmt.Errorf("symbol table out of range")
+		}
+
+		strtab := newStringTableBuilder(ret[stroff : stroff+strsize])
+		changed := false
+		for j := 0; j < nsyms; j++ {
+			nlist := ret[symoff+j*nlistSize:]
+			ntype := nlist[4]
+			if ntype&machoN_STAB != 0 || ntype&machoN_EXT == 0 {
+				continue
+			}
+			name, err := cString(strtab.table, int(order.Uint32(nlist)))
+			if err != nil {
+				return nil, err
+			}
+			newName, ok := names[name]
+			if !ok || newName == name {
+				continue
+			}
+			order.PutUint32(nlist, uint32(strtab.add(newName)))
+			changed = true
+		}
+		if !changed {
+			return nil, nil
+		}
+
+		// grow the string table in place when it is placed at the end of
+		// file, otherwise move it to the end of file.
+		if stroff+strsize == len(ret) {
+			ret = append(ret[:stroff], strtab.table...)
+		} else {
+			for len(ret)%8 != 0 {
+				ret = append(ret, 0)
+			}
+			stroff = len(ret)
+			ret = append(ret, strtab.table...)
+		}
+		for len(strtab.table)%8 != 0 {
+			strtab.table = append(strtab.table, 0)
+			ret = append(ret, 0)
+		}
+		order.PutUint32(ret[offset+16:], uint32(stroff))
+		order.PutUint32(ret[offset+20:], uint32(len(strtab.table)))
+		return ret, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,40 @@
+package catlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+type manifestMember struct {
+	Library string   `json:"library"`
+	Member  string   `json:"member"`
+	Base    bool     `json:"base,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+	Symbols []string `json:"symbols,omitempty"`
+}
+
+type manifest struct {
+	Semantics  string           `json:"semantics"`
+	Members    []manifestMember `json:"members"`
+	Unresolved []string         `json:"unresolved"`
+}
+
+// WriteManifest writes members included in the output, with the reason why
+// they are included, and the linker search semantics used to select them.
+func (this *Plan) WriteManifest(w io.Writer) error {
+	var m manifest
+	m.Semantics = this.Semantics
+	m.Members = []manifestMember{}
+	for _, member := range this.Members() {
+		m.Members = append(m.Members, manifestMember{member.Library, member.Name, member.IsBase(), member.Reason, member.Symbols})
+	}
+	m.Unresolved = this.Unresolved
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
@@ -0,0 +1,49 @@
+package catlib
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteManifest(t *testing.T) {
+	plan := testPlan()
+	plan.Semantics = SemanticsGNU
+	var buf bytes.Buffer
+	if err := plan.WriteManifest(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "semantics": "gnu",
+  "members": [
+    {
+      "library": "/work/base.lib",
+      "member": "base.o",
+      "base": true
+    },
+    {
+      "library": "/work/z.lib",
+      "member": "inflate.o",
+      "reason": "symbol",
+      "symbols": [
+        "inflate"
+      ]
+    },
+    {
+      "library": "/work/z.lib",
+      "member": "zutil.o",
+      "reason": "symbol",
+      "symbols": [
+        "zcalloc",
+        "zcfree"
+      ]
+    }
+  ],
+  "unresolved": [
+    "malloc"
+  ]
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
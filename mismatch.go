@@ -0,0 +1,84 @@
+package catlib
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MismatchConflict is a '/FAILIFMISMATCH' key, which has different values
+// among members of a plan. Linking the merged library fails with LNK2038.
+type MismatchConflict struct {
+	Key    string
+	Values []*MismatchValue
+}
+
+type MismatchValue struct {
+	Value string
+	// members which have '/FAILIFMISMATCH:"Key=Value"' directive.
+	Members []*PlanMember
+}
+
+// FailIfMismatchConflicts collects '/FAILIFMISMATCH' key/value pairs from
+// base and pulled members, and returns the keys with conflicting values.
+func (this *Plan) FailIfMismatchConflicts() []*MismatchConflict {
+	values := make(map[string][]*MismatchValue)
+	for _, member := range this.Members() {
+		for _, d := range member.Directives {
+			if d.Name != DirectiveFailIfMismatch {
+				continue
+			}
+			i := strings.Index(d.Value, "=")
+			if i < 0 {
+				continue
+			}
+			key := d.Value[:i]
+			value := d.Value[i+1:]
+
+			var v *MismatchValue
+			for _, existing := range values[key] {
+				if existing.Value == value {
+					v = existing
+					break
+				}
+			}
+			if v == nil {
+				v = &MismatchValue{Value: value}
+				values[key] = append(values[key], v)
+			}
+			if len(v.Members) == 0 || v.Members[len(v.Members)-1] != member {
+				v.Members = append(v.Members, member)
+			}
+		}
+	}
+
+	keys := []string{}
+	for key, v := range values {
+		if len(v) > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	ret := []*MismatchConflict{}
+	for _, key := range keys {
+		ret = append(ret, &MismatchConflict{key, values[key]})
+	}
+	return ret
+}
+
+// Error describes the conflict, naming the library and member of each value.
+// Only the first member is named for each value.
+func (this *MismatchConflict) Error() string {
+	parts := []string{}
+	for _, v := range this.Values {
+		member := v.Members[0]
+		location := fmt.Sprintf("%s:%s", filepath.Base(member.Library), member.Name)
+		if len(v.Members) > 1 {
+			location = fmt.Sprintf("%s and %d more", location, len(v.Members)-1)
+		}
+		parts = append(parts, fmt.Sprintf("'%s' in %s", v.Value, location))
+	}
+	return fmt.Sprintf("mismatch detected for '%s': %s", this.Key, strings.Join(parts, ", "))
+}
@@ -0,0 +1,50 @@
+package catlib
+
+import "testing"
+
+func TestFailIfMismatchConflicts(t *testing.T) {
+	mismatch := func(values ...string) []Directive {
+		ret := []Directive{}
+		for _, v := range values {
+			ret = append(ret, Directive{DirectiveFailIfMismatch, v})
+		}
+		return ret
+	}
+	plan := &Plan{
+		Base: []*PlanMember{
+			{Library: "/work/base.lib", Name: "a.obj", Directives: mismatch("_MSC_VER=1900", "RuntimeLibrary=MT_StaticRelease", "_ITERATOR_DEBUG_LEVEL=0"), base: true},
+			{Library: "/work/base.lib", Name: "b.obj", Directives: mismatch("RuntimeLibrary=MT_StaticRelease", "RuntimeLibrary=MT_StaticRelease"), base: true},
+		},
+		Pulled: []*PlanMember{
+			{Library: "/work/z.lib", Name: "c.obj", Directives: append(mismatch("_MSC_VER=1900", "RuntimeLibrary=MD_DynamicRelease", "bogus"), Directive{DirectiveDefaultLib, "msvcrt"})},
+			{Library: "/work/z.lib", Name: "d.obj", Directives: mismatch("_ITERATOR_DEBUG_LEVEL=2", "RuntimeLibrary=MD_DynamicRelease")},
+		},
+	}
+	conflicts := plan.FailIfMismatchConflicts()
+	want := []string{
+		"mismatch detected for 'RuntimeLibrary': 'MT_StaticRelease' in base.lib:a.obj and 1 more, 'MD_DynamicRelease' in z.lib:c.obj and 1 more",
+		"mismatch detected for '_ITERATOR_DEBUG_LEVEL': '0' in base.lib:a.obj, '2' in z.lib:d.obj",
+	}
+	if len(conflicts) != len(want) {
+		t.Fatalf("%d conflicts, want %d", len(conflicts), len(want))
+	}
+	for i, conflict := range conflicts {
+		if got := conflict.Error(); got != want[i] {
+			t.Errorf("'%s', want '%s'", got, want[i])
+		}
+	}
+	// a member is listed once, even if it has the same directive twice.
+	if members := conflicts[0].Values[0].Members; len(members) != 2 || members[1].Name != "b.obj" {
+		t.Errorf("members of 'MT_StaticRelease' are wrong")
+	}
+}
+
+func TestFailIfMismatchNoConflict(t *testing.T) {
+	plan := &Plan{Base: []*PlanMember{
+		{Library: "/work/base.lib", Name: "a.obj", Directives: []Directive{{DirectiveFailIfMismatch, "_MSC_VER=1900"}}, base: true},
+		{Library: "/work/base.lib", Name: "b.obj", Directives: []Directive{{DirectiveFailIfMismatch, "_MSC_VER=1900"}}, base: true},
+	}}
+	if conflicts := plan.FailIfMismatchConflicts(); len(conflicts) != 0 {
+		t.Errorf("%d conflicts", len(conflicts))
+	}
+}
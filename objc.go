@@ -0,0 +1,22 @@
+package catlib
+
+import (
+	"strings"
+)
+
+// IsObjCMember returns true when the member defines Objective-C classes or
+// categories, which ld64's -ObjC option loads because they are referenced
+// dynamically.
+func IsObjCMember(exports []string, sections []string) bool {
+	for _, sym := range exports {
+		if strings.HasPrefix(sym, "_OBJC_CLASS_$_") {
+			return true
+		}
+	}
+	for _, section := range sections {
+		if section == "__objc_catlist" || section == "__objc_nlcatlist" {
+			return true
+		}
+	}
+	return false
+}
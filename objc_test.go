@@ -0,0 +1,51 @@
+package catlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsObjCMember(t *testing.T) {
+	tests := []struct {
+		exports  []string
+		sections []string
+		want     bool
+	}{
+		{[]string{"_OBJC_CLASS_$_Foo", "_OBJC_METACLASS_$_Foo"}, []string{"__text"}, true},
+		{[]string{"_foo"}, []string{"__text", "__objc_catlist"}, true},
+		{[]string{}, []string{"__objc_nlcatlist"}, true},
+		// classes referenced, not defined.
+		{[]string{"_foo"}, []string{"__text", "__objc_classrefs"}, false},
+		{[]string{"_OBJC_METACLASS_$_Foo"}, []string{"__text"}, false},
+	}
+	for _, test := range tests {
+		if got := IsObjCMember(test.exports, test.sections); got != test.want {
+			t.Errorf("%q %q: %v", test.exports, test.sections, got)
+		}
+	}
+}
+
+// classes and categories are pulled with ObjC, because they are referenced
+// only dynamically.
+func TestResolveObjC(t *testing.T) {
+	base := []testMember{{"base.o", testObject{imports: []string{"f"}}}}
+	input := testLibrary{"a.lib", []testMember{
+		{"f.o", testObject{defines: []string{"f"}}},
+		{"class.o", testObject{defines: []string{"_OBJC_CLASS_$_Foo"}, imports: []string{"g"}}},
+		{"category.o", testObject{defines: []string{"c"}, sections: []string{"__objc_catlist"}}},
+		{"g.o", testObject{defines: []string{"g"}}},
+	}}
+	tests := []struct {
+		objc   bool
+		pulled []string
+	}{
+		{false, []string{"a:f.o symbol"}},
+		{true, []string{"a:class.o objc", "a:category.o objc", "a:f.o symbol", "a:g.o symbol"}},
+	}
+	for _, test := range tests {
+		plan := resolveTestLibraries(t, ResolverOptions{Semantics: SemanticsLD64, ObjC: test.objc}, base, input)
+		if got := pullReasons(plan); !reflect.DeepEqual(got, test.pulled) {
+			t.Errorf("%v: %q, want %q", test.objc, got, test.pulled)
+		}
+	}
+}
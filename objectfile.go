@@ -3,4 +3,12 @@ package catlib
 type IObjectFile interface {
 	Open(filePath string) error
 	RemoveDefaultlibDrectve(inputLibNames []string) (keptDefaultLibNames []string, err error)
+	// RenameSymbols returns false when the symbols are not readable, such
+	// as LLVM bitcode, and the file is not modified.
+	RenameSymbols(names map[string]string) (renamed bool, err error)
+	Directives() ([]Directive, error)
+	SetDirectives(directives []Directive) error
+	MapDefaultLibs(names map[string]string) error
+	RemoveExportDirectives() (removedExports []string, err error)
+	VerifyChecksums() ([]string, error)
 }
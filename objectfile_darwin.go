@@ -1,13 +1,53 @@
 package catlib
 
+import (
+	"fmt"
+)
+
 type ObjectFile struct {
 	IObjectFile
+	filePath string
 }
 
 func (this *ObjectFile) Open(filePath string) error {
+	this.filePath = filePath
 	return nil
 }
 
+// RemoveDefaultlibDrectve removes LC_LINKER_OPTION load commands linking
+// libraries in inputLibNames, which is the Mach-O counterpart of
+// '-defaultlib' directives.
 func (this *ObjectFile) RemoveDefaultlibDrectve(inputLibNames []string) (keptDefaultLibNames []string, err error) {
+	return removeAutolinkLibraries(this.filePath, inputLibNames)
+}
+
+// Directives returns linker directives. Mach-O objects have no '.drectve'
+// section, so the result is always empty.
+func (this *ObjectFile) Directives() ([]Directive, error) {
+	return []Directive{}, nil
+}
+
+func (this *ObjectFile) SetDirectives(directives []Directive) error {
+	if len(directives) == 0 {
+		return nil
+	}
+	return fmt.Errorf("linker directives are not supported on macOS")
+}
+
+func (this *ObjectFile) MapDefaultLibs(names map[string]string) error {
+	return nil
+}
+
+func (this *ObjectFile) RemoveExportDirectives() (removedExports []string, err error) {
+	return []string{}, nil
+}
+
+func (this *ObjectFile) RenameSymbols(names map[string]string) (bool, error) {
+	return renameSymbols(this.filePath, names)
+}
+
+// VerifyChecksums verifies checksums of sections. Mach-O objects have no
+// section checksums, so the result is always empty.
+func (this *ObjectFile) VerifyChecksums() ([]string, error) {
 	return []string{}, nil
 }
@@ -1,12 +1,8 @@
 package catlib
 
 import (
-	"debug/pe"
 	"fmt"
-	"os"
-	"path/filepath"
-	"regexp"
-	"strings"
+	"io/ioutil"
 )
 
 type ObjectFile struct {
@@ -20,71 +16,176 @@ func (this *ObjectFile) Open(filePath string) error {
 }
 
 func (this *ObjectFile) RemoveDefaultlibDrectve(inputLibNames []string) (keptDefaultLibNames []string, err error) {
-	peFile, e := pe.Open(this.filePath)
 	keptDefaultLibNames = []string{}
-	if e != nil {
-		return []string{}, e
+	data, err := ioutil.ReadFile(this.filePath)
+	if err != nil {
+		return []string{}, err
 	}
-	defer peFile.Close()
-
-	reg := regexp.MustCompile(`-defaultlib:"[^"]*"`)
-	r := regexp.MustCompile(`-defaultlib:"([^"]*)"`)
-
-	section := peFile.Section(".drectve")
-	if section == nil {
-		return []string{}, nil
+	// '.deplibs' of ELF, or LC_LINKER_OPTION of Mach-O objects.
+	if isELF(data) || isMachO(data) {
+		return removeAutolinkLibraries(this.filePath, inputLibNames)
 	}
 
-	start := section.SectionHeader.Offset
-	length := section.SectionHeader.Size
-	data, err := section.Data()
+	directives, err := this.Directives()
 	if err != nil {
 		return []string{}, err
 	}
 
-	data = reg.ReplaceAllFunc(data, func(m []byte) []byte {
-		rr := r.FindSubmatch(m)
-		name := strings.ToLower(filepath.Base(string(rr[1])))
-		ext := filepath.Ext(name)
-		if ext != "" {
-			name = strings.TrimSuffix(name, ext)
-		}
-
-		remove := false
-		for _, n := range inputLibNames {
-			if name == n {
-				remove = true
-				break
-			}
+	kept := []Directive{}
+	for _, d := range directives {
+		if d.Name != DirectiveDefaultLib {
+			kept = append(kept, d)
+			continue
 		}
-
-		if !remove && len(inputLibNames) > 0 {
+		name := DefaultLibName(d.Value)
+		if !contains(inputLibNames, name) && len(inputLibNames) > 0 {
 			keptDefaultLibNames = append(keptDefaultLibNames, name)
-			return m
+			kept = append(kept, d)
 		}
+	}
+	if len(kept) == len(directives) {
+		return keptDefaultLibNames, nil
+	}
+
+	if err := this.SetDirectives(kept); err != nil {
+		return []string{}, err
+	}
+	return keptDefaultLibNames, nil
+}
 
-		for i := 0; i < len(m); i++ {
-			m[i] = 0x20
+// Directives returns linker directives in '.drectve' section.
+func (this *ObjectFile) Directives() ([]Directive, error) {
+	obj, err := this.read()
+	if err != nil {
+		return nil, err
+	}
+	section := obj.Section(".drectve")
+	if section == nil {
+		return []Directive{}, nil
+	}
+	return ParseDirectives(section.Data), nil
+}
+
+// SetDirectives replaces contents of '.drectve' section. The section grows
+// or shrinks as needed. Directives which are not changed are written as they
+// were.
+func (this *ObjectFile) SetDirectives(directives []Directive) error {
+	obj, err := this.read()
+	if err != nil {
+		return err
+	}
+	section := obj.Section(".drectve")
+	if section == nil {
+		if len(directives) == 0 {
+			return nil
 		}
-		return m
-	})
+		return fmt.Errorf("%s: '.drectve' section not found", this.filePath)
+	}
+	section.Data = ReformatDirectives(section.Data, directives)
+	return this.write(obj)
+}
+
+func (this *ObjectFile) read() (*COFFObject, error) {
+	data, err := ioutil.ReadFile(this.filePath)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := ReadCOFFObject(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", this.filePath, err)
+	}
+	return obj, nil
+}
 
-	if len(data) != int(length) {
-		return []string{}, fmt.Errorf("'.drectve' section length mismatch. expected %d for %d", length, len(data))
+// write writes the modified object. '.chks64' section is removed, because
+// it cannot be recomputed.
+func (this *ObjectFile) write(obj *COFFObject) error {
+	if _, err := obj.RemoveChecksumSection(); err != nil {
+		return fmt.Errorf("%s: %v", this.filePath, err)
+	}
+	data, err := obj.Bytes()
+	if err != nil {
+		return fmt.Errorf("%s: %v", this.filePath, err)
 	}
+	return ioutil.WriteFile(this.filePath, data, 0644)
+}
 
-	peFile.Close()
+// MapDefaultLibs replaces '/DEFAULTLIB' directives by names, which maps
+// library names (see DefaultLibName) to new library names.
+func (this *ObjectFile) MapDefaultLibs(names map[string]string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	directives, err := this.Directives()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i, d := range directives {
+		if d.Name != DirectiveDefaultLib {
+			continue
+		}
+		if name, ok := names[DefaultLibName(d.Value)]; ok {
+			directives[i].Value = name
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return this.SetDirectives(directives)
+}
+
+// RemoveExportDirectives removes '/EXPORT' directives, and returns names of
+// the removed exports.
+func (this *ObjectFile) RemoveExportDirectives() (removedExports []string, err error) {
+	directives, err := this.Directives()
+	if err != nil {
+		return []string{}, err
+	}
 
-	file, e1 := os.OpenFile(this.filePath, os.O_RDWR, 0777)
-	if e1 != nil {
-		return []string{}, e1
+	removedExports = []string{}
+	kept := []Directive{}
+	for _, d := range directives {
+		if d.Name == DirectiveExport {
+			removedExports = append(removedExports, ExportName(d.Value))
+		} else {
+			kept = append(kept, d)
+		}
+	}
+	if len(removedExports) == 0 {
+		return removedExports, nil
 	}
-	defer file.Close()
+	if err := this.SetDirectives(kept); err != nil {
+		return []string{}, err
+	}
+	return removedExports, nil
+}
 
-	_, e2 := file.WriteAt(data, int64(start))
-	if e2 != nil {
-		return []string{}, e2
+func (this *ObjectFile) RenameSymbols(names map[string]string) (bool, error) {
+	if len(names) == 0 {
+		return true, nil
+	}
+	renamed, err := renameSymbols(this.filePath, names)
+	if err != nil || !renamed {
+		return renamed, err
 	}
+	obj, err := this.read()
+	if err != nil {
+		return false, err
+	}
+	if obj.Section(coffChecksumSectionName) == nil {
+		return true, nil
+	}
+	return true, this.write(obj)
+}
 
-	return keptDefaultLibNames, nil
+// VerifyChecksums verifies checksums of sections, and returns descriptions
+// of mismatches.
+func (this *ObjectFile) VerifyChecksums() ([]string, error) {
+	obj, err := this.read()
+	if err != nil {
+		return nil, err
+	}
+	return obj.VerifyChecksums(), nil
 }
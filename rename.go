@@ -0,0 +1,114 @@
+package catlib
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ReadSymbolMapFile reads objcopy's '--redefine-syms' style file. Each line
+// has the form "old new", and everything after '#' is ignored.
+func ReadSymbolMapFile(filePath string) (map[string]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := make(map[string]string)
+	s := bufio.NewScanner(f)
+	lineNumber := 0
+	for s.Scan() {
+		lineNumber++
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"old new\" but got \"%s\"", filePath, lineNumber, strings.TrimSpace(line))
+		}
+		ret[fields[0]] = fields[1]
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// renameSymbols renames external symbols (both definitions and references)
+// of the object file at filePath. The object format is detected from its
+// magic, so COFF, ELF and Mach-O objects are all accepted. It returns false
+// without modifying the file when the symbols are not readable, such as LLVM
+// bitcode, anonymous COFF objects and unknown contents.
+func renameSymbols(filePath string, names map[string]string) (bool, error) {
+	if len(names) == 0 {
+		return true, nil
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	var renamed []byte
+	switch {
+	case isELF(data):
+		renamed, err = renameELFSymbols(data, names)
+	case isMachO(data):
+		renamed, err = renameMachOSymbols(data, names)
+	default:
+		if info := readObjectInfo(data); info.format != ObjectFormatCOFF || info.opaque {
+			return false, nil
+		}
+		renamed, err = renameCOFFSymbols(data, names)
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", filePath, err)
+	}
+	if renamed == nil {
+		return true, nil
+	}
+	return true, ioutil.WriteFile(filePath, renamed, 0644)
+}
+
+// stringTableBuilder appends new names to an existing string table, reusing
+// names which have already been appended.
+type stringTableBuilder struct {
+	table   []byte
+	offsets map[string]int
+}
+
+func newStringTableBuilder(table []byte) *stringTableBuilder {
+	b := new(stringTableBuilder)
+	b.table = append([]byte{}, table...)
+	b.offsets = make(map[string]int)
+	return b
+}
+
+func (b *stringTableBuilder) add(name string) int {
+	if offset, ok := b.offsets[name]; ok {
+		return offset
+	}
+	offset := len(b.table)
+	b.table = append(b.table, name...)
+	b.table = append(b.table, 0)
+	b.offsets[name] = offset
+	return offset
+}
+
+func cString(data []byte, offset int) (string, error) {
+	if offset < 0 || offset >= len(data) {
+		return "", fmt.Errorf("string offset %d out of range", offset)
+	}
+	end := bytes.IndexByte(data[offset:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("string at offset %d is not terminated", offset)
+	}
+	return string(data[offset : offset+end]), nil
+}
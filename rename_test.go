@@ -0,0 +1,141 @@
+package catlib
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// renameTestObject writes data into a temporary file, renames its symbols,
+// and returns the renamed contents.
+func renameTestObject(t *testing.T, data []byte, names map[string]string) []byte {
+	filePath := filepath.Join(t.TempDir(), "x.o")
+	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := renameSymbols(filePath, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !renamed {
+		t.Fatal("not renamed")
+	}
+	ret, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func sortedSymbols(info objectInfo) []string {
+	ret := []string{}
+	for _, sym := range info.symbols {
+		ret = append(ret, string(sym.kind)+" "+sym.name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// names longer than 8 characters are moved to the string table, and
+// '.drectve' refers the renamed symbols.
+func TestRenameCOFFSymbols(t *testing.T) {
+	object := testObject{
+		defines:    []string{"f", "a_function_with_a_long_name"},
+		imports:    []string{"g"},
+		directives: "/EXPORT:f /EXPORT:a_function_with_a_long_name,DATA /INCLUDE:g /ALTERNATENAME:h=f",
+	}
+	// bytes after the string table, such as debug information some tools
+	// append, are kept.
+	data := append(object.coff(), "TRAILING"...)
+	renamed := renameTestObject(t, data, map[string]string{
+		"f":                           "renamed_f_with_a_long_name",
+		"a_function_with_a_long_name": "short",
+		"g":                           "renamed_g_with_a_long_name",
+	})
+
+	if got, want := sortedSymbols(readObjectInfo(renamed)), []string{"T renamed_f_with_a_long_name", "T short", "U renamed_g_with_a_long_name"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("symbols %q, want %q", got, want)
+	}
+	obj, err := ReadCOFFObject(renamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Directive{
+		{DirectiveExport, "f=renamed_f_with_a_long_name"},
+		{DirectiveExport, "a_function_with_a_long_name=short,DATA"},
+		{DirectiveInclude, "renamed_g_with_a_long_name"},
+		{DirectiveAlternateName, "h=renamed_f_with_a_long_name"},
+	}
+	if got := ParseDirectives(obj.Section(".drectve").Data); !reflect.DeepEqual(got, want) {
+		t.Errorf("directives %q, want %q", got, want)
+	}
+	if r := obj.Section(".text").Relocations; len(r) != 1 || r[0].Symbol.Name != "renamed_g_with_a_long_name" {
+		t.Errorf("relocation does not refer the renamed symbol")
+	}
+	if !bytes.Contains(renamed, []byte("TRAILING")) {
+		t.Errorf("trailing bytes are not kept")
+	}
+}
+
+// testdata/deplibs.o defines 'f'.
+func TestRenameELFSymbols(t *testing.T) {
+	renamed := renameTestObject(t, readTestData(t, "deplibs.o"), map[string]string{"f": "a_much_longer_name_of_f"})
+	f, err := elf.NewFile(bytes.NewReader(renamed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbols, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, sym := range symbols {
+		if elf.ST_BIND(sym.Info) == elf.STB_GLOBAL {
+			names = append(names, sym.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"a_much_longer_name_of_f"}) {
+		t.Errorf("global symbols %q", names)
+	}
+	if got := f.Section(".deplibs"); got == nil {
+		t.Errorf("'.deplibs' section is lost")
+	}
+}
+
+// testdata/linker_option.o defines '_f'.
+func TestRenameMachOSymbols(t *testing.T) {
+	renamed := renameTestObject(t, readTestData(t, "linker_option.o"), map[string]string{"_f": "_a_much_longer_name_of_f"})
+	f, err := macho.NewFile(bytes.NewReader(renamed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, sym := range f.Symtab.Syms {
+		names = append(names, sym.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"_a_much_longer_name_of_f"}) {
+		t.Errorf("symbols %q", names)
+	}
+}
+
+// symbols of LLVM bitcode are not readable, so the file is kept as is.
+func TestRenameUnreadableSymbols(t *testing.T) {
+	for _, data := range [][]byte{[]byte("BC\xc0\xde\x35\x14\x00\x00"), []byte("unknown contents")} {
+		filePath := filepath.Join(t.TempDir(), "x.o")
+		if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		renamed, err := renameSymbols(filePath, map[string]string{"f": "g"})
+		if err != nil || renamed {
+			t.Errorf("%q: renamed %v, %v", data, renamed, err)
+		}
+		if got, _ := ioutil.ReadFile(filePath); !bytes.Equal(got, data) {
+			t.Errorf("%q: modified", data)
+		}
+	}
+}
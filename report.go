@@ -0,0 +1,166 @@
+package catlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MergeReport is the result of merging libraries, written as a JSON document
+// by 'catlib merge --format=json'. Lists are empty rather than null.
+type MergeReport struct {
+	// false when merging is aborted, and Errors has the reasons.
+	Success   bool   `json:"success"`
+	Semantics string `json:"semantics"`
+	// file path of the output library. empty when it is not written.
+	Output string `json:"output"`
+	// members pulled from each input library, in the order the libraries
+	// first pulled a member.
+	Inputs []ReportInput `json:"inputs"`
+	// symbols resolved by pulled members.
+	Resolved []ReportSymbol `json:"resolved"`
+	// base members unreachable from '--roots', and dropped.
+	DroppedBase []ReportMember `json:"droppedBase"`
+	// '-defaultlib' (or autolinked) libraries kept in the output.
+	KeptDefaultLibs []string `json:"keptDefaultLibs"`
+	// '/EXPORT' directives removed by '--strip-exports' and
+	// '--strip-base-exports'.
+	RemovedExports []ReportMember     `json:"removedExports"`
+	Unresolved     []UnresolvedMember `json:"unresolved"`
+	// reference chain printed by '--why'. nil without '--why'.
+	Why      *ReportWhy      `json:"why,omitempty"`
+	Warnings []ReportMessage `json:"warnings"`
+	Errors   []ReportMessage `json:"errors"`
+	Timing   ReportTiming    `json:"timing"`
+}
+
+type ReportInput struct {
+	Library string         `json:"library"`
+	Members []ReportMember `json:"members"`
+}
+
+type ReportMember struct {
+	Library string `json:"library"`
+	Member  string `json:"member"`
+	// why the member is pulled, one of PullReason* constants. empty for
+	// base members.
+	Reason string `json:"reason,omitempty"`
+	Size   int64  `json:"size"`
+	// symbols resolved by the member.
+	Symbols []string `json:"symbols,omitempty"`
+	// removed '/EXPORT' directive values.
+	Exports []string `json:"exports,omitempty"`
+}
+
+type ReportSymbol struct {
+	Name    string `json:"name"`
+	Library string `json:"library"`
+	Member  string `json:"member"`
+}
+
+type ReportWhy struct {
+	Target string `json:"target"`
+	// references from a root member to the target. empty when the target
+	// is a root member, or is not pulled.
+	Chain []ReportReference `json:"chain"`
+	// why the target is a root member, "base" or one of PullReason*
+	// constants. empty otherwise.
+	Root string `json:"root,omitempty"`
+}
+
+type ReportReference struct {
+	// members in "lib:member" form.
+	From   string `json:"from"`
+	Symbol string `json:"symbol"`
+	To     string `json:"to"`
+}
+
+// ReportMessage is a warning or an error, such as 'ABORT' of the text
+// output, with the list of symbols or members it is about.
+type ReportMessage struct {
+	Message string   `json:"message"`
+	Items   []string `json:"items,omitempty"`
+}
+
+// ReportTiming has elapsed time of each phase in seconds.
+type ReportTiming struct {
+	Resolve float64 `json:"resolve"`
+	Extract float64 `json:"extract"`
+	Concat  float64 `json:"concat"`
+	// checking the output with VerifyArchive.
+	Verify float64 `json:"verify"`
+	Total  float64 `json:"total"`
+}
+
+func NewMergeReport() *MergeReport {
+	r := new(MergeReport)
+	r.Success = true
+	r.Inputs = []ReportInput{}
+	r.Resolved = []ReportSymbol{}
+	r.DroppedBase = []ReportMember{}
+	r.KeptDefaultLibs = []string{}
+	r.RemovedExports = []ReportMember{}
+	r.Unresolved = []UnresolvedMember{}
+	r.Warnings = []ReportMessage{}
+	r.Errors = []ReportMessage{}
+	return r
+}
+
+// SetPlan fills members and symbols selected by the plan.
+func (this *MergeReport) SetPlan(plan *Plan) {
+	this.Semantics = plan.Semantics
+	index := make(map[string]int)
+	for _, member := range plan.Pulled {
+		i, ok := index[member.Library]
+		if !ok {
+			i = len(this.Inputs)
+			index[member.Library] = i
+			this.Inputs = append(this.Inputs, ReportInput{member.Library, []ReportMember{}})
+		}
+		this.Inputs[i].Members = append(this.Inputs[i].Members, newReportMember(member))
+		for _, sym := range member.Symbols {
+			this.Resolved = append(this.Resolved, ReportSymbol{sym, member.Library, member.Name})
+		}
+	}
+	for _, member := range plan.DroppedBase {
+		this.DroppedBase = append(this.DroppedBase, newReportMember(member))
+	}
+}
+
+// SetWhy sets the result of Plan.Why for the target.
+func (this *MergeReport) SetWhy(plan *Plan, target string, chain []Reference) {
+	this.Why = &ReportWhy{Target: target, Chain: []ReportReference{}}
+	for _, ref := range chain {
+		this.Why.Chain = append(this.Why.Chain, ReportReference{ref.From.Label(), ref.Symbol, ref.To.Label()})
+	}
+	if member := plan.FindMember(target); len(chain) == 0 && member != nil {
+		if member.IsBase() {
+			this.Why.Root = "base"
+		} else {
+			this.Why.Root = member.Reason
+		}
+	}
+}
+
+// Fail records an error, and marks the report as failed.
+func (this *MergeReport) Fail(message string, items []string) {
+	this.Success = false
+	this.Errors = append(this.Errors, ReportMessage{message, items})
+}
+
+func (this *MergeReport) Warn(message string, items []string) {
+	this.Warnings = append(this.Warnings, ReportMessage{message, items})
+}
+
+func newReportMember(member *PlanMember) ReportMember {
+	return ReportMember{Library: member.Library, Member: member.Name, Reason: member.Reason, Size: member.Size, Symbols: member.Symbols}
+}
+
+func (this *MergeReport) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
@@ -0,0 +1,696 @@
+package catlib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+type ResolverOptions struct {
+	// file paths of base static libraries or object files. All of their
+	// members are included.
+	Bases []string
+	// file paths of libraries searched for undefined symbols, in priority order.
+	Inputs []string
+	// file paths in Inputs, all of whose members are included unconditionally.
+	WholeArchiveInputs []string
+	// symbols (or wildcard patterns) the output has to provide. If not
+	// empty, base members unreachable from them are dropped.
+	Roots []string
+	// include members of inputs which have static initializers but no
+	// exported symbols. base members are always included. they are never
+	// pulled by symbols, because nobody can reference them.
+	IncludeInitializers bool
+	// include members of inputs which define Objective-C classes or
+	// categories, same as ld64's -ObjC option.
+	ObjC bool
+	// x86_64 or i386 (macOS only)
+	Arch string
+	// how inputs are searched, one of Semantics* constants. The default is
+	// the one of host linker.
+	Semantics string
+	// called each time a symbol is resolved, if not nil. depth is the length
+	// of the reference chain from base members to the symbol.
+	Progress func(depth int, numResolved int, symbol string)
+}
+
+const (
+	// search all inputs repeatedly, the first input defining a symbol wins.
+	SemanticsMSVC = "msvc"
+	SemanticsLD64 = "ld64"
+	// search each input once in order, like GNU ld without --start-group.
+	// Inputs are never searched again once passed, so symbols referenced
+	// after the first pass, like targets of '/ALTERNATENAME', are looked up
+	// only in the last input.
+	SemanticsGNU = "gnu"
+	// search inputs repeatedly in order, like GNU ld with --start-group.
+	SemanticsGNUGroup = "gnu-group"
+)
+
+func defaultSemantics() string {
+	switch runtime.GOOS {
+	case "windows":
+		return SemanticsMSVC
+	case "darwin":
+		return SemanticsLD64
+	default:
+		return SemanticsGNU
+	}
+}
+
+type Resolver struct {
+	options  ResolverOptions
+	baseLibs []*LibFile
+	libs     []*LibFile
+}
+
+const (
+	PullReasonSymbol       = "symbol"
+	PullReasonWholeArchive = "whole-archive"
+	PullReasonInitializer  = "initializer"
+	PullReasonObjC         = "objc"
+)
+
+type PlanMember struct {
+	Library string
+	Index   int
+	Name    string
+	// why this member is pulled. empty for base members.
+	Reason string
+	// symbols resolved by this member.
+	Symbols []string
+	// undefined symbols, and symbols forced by '/INCLUDE' directives.
+	Imports []string
+	Exports []string
+	// size of the member in bytes.
+	Size int64
+	// linker directives in '.drectve' section.
+	Directives []Directive
+	lib        *LibFile
+	base       bool
+}
+
+func (this *PlanMember) IsBase() bool {
+	return this.base
+}
+
+// PlanEdge is a reference from a member to another member, which defines
+// the referenced symbols.
+type PlanEdge struct {
+	From    *PlanMember
+	To      *PlanMember
+	Symbols []string
+}
+
+type Plan struct {
+	// linker search semantics used for resolution.
+	Semantics string
+	Base      []*PlanMember
+	Pulled    []*PlanMember
+	Edges     []*PlanEdge
+	// symbols which are still undefined after resolution.
+	Unresolved []string
+	// members of inputs which have static initializers but no exported
+	// symbols, and are not included. Always empty with IncludeInitializers option.
+	DroppedInitializers []*PlanMember
+	// symbols defined by more than one base member.
+	Duplicates []*DuplicateSymbol
+	// base members unreachable from Roots option, and are not included.
+	DroppedBase []*PlanMember
+	// entries of Roots option, which match no symbol of base members.
+	UnmatchedRoots []string
+}
+
+// DuplicateSymbol is a non-weak symbol defined by more than one base member,
+// which makes the merged library fail to link.
+type DuplicateSymbol struct {
+	Name    string
+	Members []*PlanMember
+}
+
+type ExtractedMember struct {
+	*PlanMember
+	// file name in the extraction directory, named after sha256 of its content.
+	FileName string
+}
+
+var (
+	objExt string
+)
+
+func init() {
+	if runtime.GOOS == "windows" {
+		objExt = ".obj"
+	} else {
+		objExt = ".o"
+	}
+}
+
+func NewResolver(options ResolverOptions) *Resolver {
+	r := new(Resolver)
+	r.options = options
+	return r
+}
+
+func (this *Resolver) Close() {
+	for _, lib := range this.baseLibs {
+		lib.Close()
+	}
+	this.baseLibs = nil
+	for _, lib := range this.libs {
+		lib.Close()
+	}
+	this.libs = nil
+}
+
+func (this *Resolver) open() error {
+	if this.baseLibs != nil {
+		return nil
+	}
+	baseLibs, err := openLibFiles(this.options.Bases, this.options.Arch, openRoot)
+	if err != nil {
+		return err
+	}
+
+	libs, err := openLibFiles(this.options.Inputs, this.options.Arch, (*LibFile).Open)
+	if err != nil {
+		for _, lib := range baseLibs {
+			lib.Close()
+		}
+		return err
+	}
+	this.baseLibs = baseLibs
+	this.libs = libs
+	return nil
+}
+
+// openRoot opens a base file, either a static library or an object file.
+func openRoot(lib *LibFile, filePath string, arch string) error {
+	archive, err := IsArchiveFile(filePath)
+	if err != nil {
+		return err
+	}
+	if archive {
+		return lib.Open(filePath, arch)
+	}
+	return lib.OpenObject(filePath, arch)
+}
+
+// IsArchiveFile returns true when the file is a static library rather than an
+// object file. Universal binaries are treated as libraries unless named '.o'.
+func IsArchiveFile(filePath string) (bool, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 8)
+	n, _ := io.ReadFull(f, magic)
+	magic = magic[:n]
+	if bytes.Equal(magic, []byte("!<arch>\n")) {
+		return true, nil
+	}
+	if bytes.HasPrefix(magic, []byte{0xca, 0xfe, 0xba, 0xbe}) {
+		return filepath.Ext(filePath) != ".o", nil
+	}
+	return false, nil
+}
+
+func openLibFiles(files []string, arch string, open func(lib *LibFile, filePath string, arch string) error) ([]*LibFile, error) {
+	ret := make([]*LibFile, len(files))
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file, arch string) {
+			defer wg.Done()
+
+			lib := new(LibFile)
+			errs[i] = open(lib, file, arch)
+			ret[i] = lib
+		}(i, file, arch)
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			for _, lib := range ret {
+				lib.Close()
+			}
+			return nil, fmt.Errorf("%s: %v", files[i], err)
+		}
+	}
+	return ret, nil
+}
+
+func symbolNames(symbols []Symbol) []string {
+	ret := []string{}
+	for _, sym := range symbols {
+		ret = append(ret, sym.Name())
+	}
+	return ret
+}
+
+type memberLocation struct {
+	lib   int
+	index int
+}
+
+type pendingSymbol struct {
+	name string
+	// length of the reference chain from base members.
+	depth int
+}
+
+func newPlanMember(lib *LibFile, library string, index int) *PlanMember {
+	m := new(PlanMember)
+	m.Library = library
+	m.Index = index
+	m.Name = lib.MemberName(index)
+	m.Symbols = []string{}
+	m.Imports = symbolNames(lib.ImportSymbols(index))
+	m.Exports = symbolNames(lib.ExportSymbols(index))
+	m.Size = lib.MemberSize(index)
+	m.Directives = lib.Directives(index)
+	for _, d := range m.Directives {
+		if d.Name == DirectiveInclude && !contains(m.Imports, d.Value) && !contains(m.Exports, d.Value) {
+			m.Imports = append(m.Imports, d.Value)
+		}
+	}
+	m.lib = lib
+	return m
+}
+
+// Resolve opens libraries, and computes members pulled from inputs to
+// resolve undefined symbols of the base libraries.
+func (this *Resolver) Resolve(ctx context.Context) (*Plan, error) {
+	if err := this.open(); err != nil {
+		return nil, err
+	}
+
+	plan := new(Plan)
+	plan.Semantics = this.options.Semantics
+	if plan.Semantics == "" {
+		plan.Semantics = defaultSemantics()
+	}
+	switch plan.Semantics {
+	case SemanticsMSVC, SemanticsLD64, SemanticsGNU, SemanticsGNUGroup:
+	default:
+		return nil, fmt.Errorf("unknown semantics '%s'", plan.Semantics)
+	}
+
+	for k, baseLib := range this.baseLibs {
+		for i := 0; i < baseLib.NumMembers(); i++ {
+			member := newPlanMember(baseLib, this.options.Bases[k], i)
+			member.base = true
+			// base members are all kept, including ones which have only
+			// static initializers.
+			if len(member.Exports) == 0 && len(member.Imports) == 0 && !HasInitializer(baseLib.Sections(i)) {
+				continue
+			}
+			plan.Base = append(plan.Base, member)
+		}
+	}
+	if len(this.options.Roots) > 0 {
+		plan.Base, plan.DroppedBase, plan.UnmatchedRoots = pruneBase(plan.Base, this.options.Roots)
+	}
+
+	// base members by the non-weak symbols defined by them.
+	strongDefinitions := make(map[string][]*PlanMember)
+	for _, member := range plan.Base {
+		exports := member.lib.ExportSymbols(member.Index)
+		for j := range exports {
+			if !exports[j].IsWeak() {
+				name := exports[j].Name()
+				strongDefinitions[name] = append(strongDefinitions[name], member)
+			}
+		}
+	}
+	duplicates := NewStringSet()
+	for name, members := range strongDefinitions {
+		if len(members) > 1 {
+			duplicates.Put(name)
+		}
+	}
+	for _, name := range duplicates.SortedValues() {
+		plan.Duplicates = append(plan.Duplicates, &DuplicateSymbol{name, strongDefinitions[name]})
+	}
+
+	// index of symbol definitions for each input. The first definition in
+	// the input wins.
+	indices := make([]map[string]int, len(this.libs))
+	for k, lib := range this.libs {
+		indices[k] = make(map[string]int)
+		for i := 0; i < lib.NumMembers(); i++ {
+			for _, sym := range lib.ExportSymbols(i) {
+				if _, ok := indices[k][sym.Name()]; !ok {
+					indices[k][sym.Name()] = i
+				}
+			}
+		}
+	}
+
+	queued := NewStringSet()
+	worklist := []pendingSymbol{}
+	enqueue := func(symbols []string, depth int) {
+		for _, sym := range symbols {
+			if !queued.Has(sym) {
+				queued.Put(sym)
+				worklist = append(worklist, pendingSymbol{sym, depth})
+			}
+		}
+	}
+	// '/ALTERNATENAME:from=to' directives of base and pulled members. The
+	// first one wins.
+	alternateNames := make(map[string]string)
+	addAlternateNames := func(member *PlanMember) {
+		for _, d := range member.Directives {
+			if d.Name != DirectiveAlternateName {
+				continue
+			}
+			i := strings.Index(d.Value, "=")
+			if i < 0 {
+				continue
+			}
+			if _, ok := alternateNames[d.Value[:i]]; !ok {
+				alternateNames[d.Value[:i]] = d.Value[i+1:]
+			}
+		}
+	}
+
+	// symbols imported by a base member but defined by another one are not
+	// looked up in inputs.
+	baseDefinedBy := make(map[string]*PlanMember)
+	for _, member := range plan.Base {
+		for _, sym := range member.Exports {
+			queued.Put(sym)
+			if _, ok := baseDefinedBy[sym]; !ok {
+				baseDefinedBy[sym] = member
+			}
+		}
+		addAlternateNames(member)
+	}
+	for _, member := range plan.Base {
+		enqueue(member.Imports, 1)
+	}
+
+	// pulled members, and the pulled members by the symbols defined by them.
+	pulled := make(map[memberLocation]*PlanMember)
+	definedBy := make(map[string]*PlanMember)
+	pull := func(loc memberLocation, reason string, depth int) *PlanMember {
+		if member, ok := pulled[loc]; ok {
+			return member
+		}
+		member := newPlanMember(this.libs[loc.lib], this.options.Inputs[loc.lib], loc.index)
+		member.Reason = reason
+		pulled[loc] = member
+		plan.Pulled = append(plan.Pulled, member)
+		addAlternateNames(member)
+		// linkers treat all symbols of loaded members as defined, so that
+		// later references to them never pull another definition.
+		for _, sym := range member.Exports {
+			if _, ok := definedBy[sym]; !ok {
+				definedBy[sym] = member
+			}
+		}
+		enqueue(member.Imports, depth)
+		return member
+	}
+
+	for k, inputFile := range this.options.Inputs {
+		if !contains(this.options.WholeArchiveInputs, inputFile) {
+			continue
+		}
+		for i := 0; i < this.libs[k].NumMembers(); i++ {
+			pull(memberLocation{k, i}, PullReasonWholeArchive, 1)
+		}
+	}
+
+	if this.options.ObjC {
+		for k, lib := range this.libs {
+			for i := 0; i < lib.NumMembers(); i++ {
+				if IsObjCMember(symbolNames(lib.ExportSymbols(i)), lib.Sections(i)) {
+					pull(memberLocation{k, i}, PullReasonObjC, 1)
+				}
+			}
+		}
+	}
+
+	initializers := []memberLocation{}
+	for k, lib := range this.libs {
+		for i := 0; i < lib.NumMembers(); i++ {
+			if len(lib.ExportSymbols(i)) == 0 && HasInitializer(lib.Sections(i)) {
+				initializers = append(initializers, memberLocation{k, i})
+			}
+		}
+	}
+	if this.options.IncludeInitializers {
+		for _, loc := range initializers {
+			pull(loc, PullReasonInitializer, 1)
+		}
+	}
+
+	// symbols looked up but not defined yet.
+	undefined := []pendingSymbol{}
+	totalNumResolved := 0
+
+	// drain resolves symbols in worklist by lookup, including the ones newly
+	// referenced by pulled members. It returns true when any member is pulled.
+	drain := func(lookup func(symbol string) (memberLocation, bool)) (bool, error) {
+		pulledAny := false
+		for len(worklist) > 0 {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+
+			current := worklist[0]
+			worklist = worklist[1:]
+
+			member, ok := definedBy[current.name]
+			if !ok {
+				loc, found := lookup(current.name)
+				if !found {
+					undefined = append(undefined, current)
+					continue
+				}
+				member = pull(loc, PullReasonSymbol, current.depth+1)
+				definedBy[current.name] = member
+				pulledAny = true
+			}
+			member.Symbols = append(member.Symbols, current.name)
+
+			totalNumResolved++
+			if this.options.Progress != nil {
+				this.options.Progress(current.depth, totalNumResolved, current.name)
+			}
+		}
+		return pulledAny, nil
+	}
+
+	// the archive GNU ld is searching. it never goes back to earlier
+	// archives, even for symbols referenced after the first pass, like
+	// alternate names.
+	position := 0
+	search := func() error {
+		switch plan.Semantics {
+		case SemanticsMSVC, SemanticsLD64:
+			_, err := drain(func(symbol string) (memberLocation, bool) {
+				for k, index := range indices {
+					if i, ok := index[symbol]; ok {
+						return memberLocation{k, i}, true
+					}
+				}
+				return memberLocation{}, false
+			})
+			return err
+		case SemanticsGNU, SemanticsGNUGroup:
+			for true {
+				pulledAny := false
+				for k := position; k < len(indices); k++ {
+					index := indices[k]
+					if plan.Semantics == SemanticsGNU {
+						position = k
+					}
+					worklist = append(undefined, worklist...)
+					undefined = []pendingSymbol{}
+					p, err := drain(func(symbol string) (memberLocation, bool) {
+						i, ok := index[symbol]
+						return memberLocation{k, i}, ok
+					})
+					if err != nil {
+						return err
+					}
+					pulledAny = pulledAny || p
+				}
+				if plan.Semantics == SemanticsGNU || !pulledAny {
+					break
+				}
+			}
+		}
+		return nil
+	}
+
+	// resolveAlternateNames resolves undefined symbols by their alternate
+	// names, same as link.exe does after all other resolution fails. It
+	// returns true when it enqueues new symbols or resolves any.
+	resolveAlternateNames := func() bool {
+		// symbols left in worklist when there is no input.
+		undefined = append(undefined, worklist...)
+		worklist = []pendingSymbol{}
+
+		progress := false
+		remaining := []pendingSymbol{}
+		for _, sym := range undefined {
+			alternate, ok := alternateNames[sym.name]
+			if !ok {
+				remaining = append(remaining, sym)
+				continue
+			}
+			if member, ok := definedBy[alternate]; ok {
+				definedBy[sym.name] = member
+				progress = true
+				continue
+			}
+			if _, ok := baseDefinedBy[alternate]; ok {
+				progress = true
+				continue
+			}
+			if !queued.Has(alternate) {
+				enqueue([]string{alternate}, sym.depth)
+				progress = true
+			}
+			remaining = append(remaining, sym)
+		}
+		undefined = remaining
+		return progress
+	}
+
+	for true {
+		if err := search(); err != nil {
+			return nil, err
+		}
+		if !resolveAlternateNames() {
+			break
+		}
+	}
+
+	unresolved := NewStringSet()
+	for _, sym := range undefined {
+		unresolved.Put(sym.name)
+	}
+	plan.Unresolved = unresolved.SortedValues()
+	for _, loc := range initializers {
+		if _, ok := pulled[loc]; !ok {
+			plan.DroppedInitializers = append(plan.DroppedInitializers, newPlanMember(this.libs[loc.lib], this.options.Inputs[loc.lib], loc.index))
+		}
+	}
+	plan.Edges = computeEdges(plan, definedBy)
+	return plan, nil
+}
+
+func computeEdges(plan *Plan, definedBy map[string]*PlanMember) []*PlanEdge {
+	ret := []*PlanEdge{}
+	for _, from := range plan.Members() {
+		edges := make(map[*PlanMember]*PlanEdge)
+		for _, sym := range from.Imports {
+			to, ok := definedBy[sym]
+			if !ok {
+				continue
+			}
+			edge, ok := edges[to]
+			if !ok {
+				edge = &PlanEdge{From: from, To: to}
+				edges[to] = edge
+				ret = append(ret, edge)
+			}
+			edge.Symbols = append(edge.Symbols, sym)
+		}
+	}
+	return ret
+}
+
+// Members returns base members followed by pulled members.
+func (this *Plan) Members() []*PlanMember {
+	ret := []*PlanMember{}
+	ret = append(ret, this.Base...)
+	ret = append(ret, this.Pulled...)
+	return ret
+}
+
+// Extract extracts base and pulled members of the plan into directory. If
+// process is not nil, it is called for each extracted object file before the
+// file is renamed after its sha256, possibly from multiple goroutines.
+func (this *Resolver) Extract(ctx context.Context, plan *Plan, directory string, process func(member *PlanMember, objectFile string) error) ([]ExtractedMember, error) {
+	members := plan.Members()
+
+	ret := make([]ExtractedMember, len(members))
+	errs := make([]error, len(members))
+	m := new(sync.Mutex)
+	var wg sync.WaitGroup
+
+	for i, member := range members {
+		wg.Add(1)
+		go func(i int, member *PlanMember) {
+			defer wg.Done()
+
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+				return
+			}
+
+			p := filepath.Join(directory, fmt.Sprintf("%d%s", i, objExt))
+			f, err := os.Create(p)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			err = member.lib.Extract(member.Index, f)
+			f.Close()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			if process != nil {
+				if err := process(member, p); err != nil {
+					errs[i] = err
+					return
+				}
+			}
+
+			newname := fmt.Sprintf("%s%s", Sha256sum(p), objExt)
+			newp := filepath.Join(directory, newname)
+			for true {
+				if err := os.Rename(p, newp); err != nil {
+					m.Lock()
+					fmt.Fprintf(os.Stderr, "Info: retry renaming %s\n", p)
+					fmt.Fprintf(os.Stderr, "Reason:\n")
+					fmt.Fprintf(os.Stderr, "\t%v\n", err)
+					m.Unlock()
+					continue
+				}
+				break
+			}
+
+			ret[i] = ExtractedMember{member, newname}
+		}(i, member)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
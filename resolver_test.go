@@ -0,0 +1,398 @@
+package catlib
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+var allSemantics = []string{SemanticsMSVC, SemanticsLD64, SemanticsGNU, SemanticsGNUGroup}
+
+type testLibrary struct {
+	name    string
+	members []testMember
+}
+
+// resolveTestLibraries writes base and inputs into a temporary directory, and
+// resolves undefined symbols of base. Names in options.WholeArchiveInputs
+// are library names.
+func resolveTestLibraries(t *testing.T, options ResolverOptions, base []testMember, inputs ...testLibrary) *Plan {
+	dir := t.TempDir()
+	options.Bases = []string{writeTestLibrary(t, dir, "base.lib", base)}
+	options.Inputs = []string{}
+	for _, lib := range inputs {
+		options.Inputs = append(options.Inputs, writeTestLibrary(t, dir, lib.name, lib.members))
+	}
+	wholeArchiveInputs := []string{}
+	for _, name := range options.WholeArchiveInputs {
+		wholeArchiveInputs = append(wholeArchiveInputs, filepath.Join(dir, name))
+	}
+	options.WholeArchiveInputs = wholeArchiveInputs
+	options.Arch = "x86_64"
+	return resolveTest(t, options)
+}
+
+func resolveTest(t *testing.T, options ResolverOptions) *Plan {
+	resolver := NewResolver(options)
+	defer resolver.Close()
+	plan, err := resolver.Resolve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func memberLabels(members []*PlanMember) []string {
+	ret := []string{}
+	for _, member := range members {
+		ret = append(ret, member.Label())
+	}
+	return ret
+}
+
+func unresolvedSymbols(plan *Plan) []string {
+	return append([]string{}, plan.Unresolved...)
+}
+
+func TestResolve(t *testing.T) {
+	base := []testMember{{"base.o", testObject{defines: []string{"main"}, imports: []string{"f", "g", "x"}}}}
+	tests := []struct {
+		name   string
+		base   []testMember
+		inputs []testLibrary
+		// expected members of the plan and unresolved symbols, unless the
+		// semantics has its own expectation.
+		members               []string
+		unresolved            []string
+		membersBySemantics    map[string][]string
+		unresolvedBySemantics map[string][]string
+	}{
+		{
+			name: "first input wins",
+			base: base,
+			inputs: []testLibrary{
+				{"a.lib", []testMember{{"a.o", testObject{defines: []string{"f", "g"}}}}},
+				{"b.lib", []testMember{{"b.o", testObject{defines: []string{"f", "g"}}}}},
+			},
+			members:    []string{"base.o", "a:a.o"},
+			unresolved: []string{"x"},
+		},
+		{
+			name: "first member in input wins",
+			base: base,
+			inputs: []testLibrary{
+				{"a.lib", []testMember{
+					{"a1.o", testObject{defines: []string{"f"}}},
+					{"a2.o", testObject{defines: []string{"f", "g"}}},
+				}},
+			},
+			members:    []string{"base.o", "a:a1.o", "a:a2.o"},
+			unresolved: []string{"x"},
+		},
+		{
+			// GNU ld searches each archive until nothing is pulled from it,
+			// before moving to the next one.
+			name: "pull order",
+			base: base,
+			inputs: []testLibrary{
+				{"a.lib", []testMember{
+					{"f.o", testObject{defines: []string{"f"}, imports: []string{"h"}}},
+					{"h.o", testObject{defines: []string{"h"}}},
+				}},
+				{"b.lib", []testMember{{"g.o", testObject{defines: []string{"g"}}}}},
+			},
+			members:    []string{"base.o", "a:f.o", "b:g.o", "a:h.o"},
+			unresolved: []string{"x"},
+			membersBySemantics: map[string][]string{
+				SemanticsGNU:      {"base.o", "a:f.o", "a:h.o", "b:g.o"},
+				SemanticsGNUGroup: {"base.o", "a:f.o", "a:h.o", "b:g.o"},
+			},
+		},
+		{
+			// 'h' referenced by 'b:g.o' is defined by an earlier input, which
+			// GNU ld does not search again.
+			name: "backward reference",
+			base: base,
+			inputs: []testLibrary{
+				{"a.lib", []testMember{
+					{"f.o", testObject{defines: []string{"f"}}},
+					{"h.o", testObject{defines: []string{"h"}}},
+				}},
+				{"b.lib", []testMember{{"g.o", testObject{defines: []string{"g"}, imports: []string{"h"}}}}},
+			},
+			members:    []string{"base.o", "a:f.o", "b:g.o", "a:h.o"},
+			unresolved: []string{"x"},
+			membersBySemantics: map[string][]string{
+				SemanticsGNU: {"base.o", "a:f.o", "b:g.o"},
+			},
+			unresolvedBySemantics: map[string][]string{
+				SemanticsGNU: {"h", "x"},
+			},
+		},
+		{
+			// symbols defined by another base member are not looked up.
+			name: "defined by base",
+			base: []testMember{
+				{"base.o", testObject{defines: []string{"main"}, imports: []string{"f", "x"}}},
+				{"f.o", testObject{defines: []string{"f"}}},
+			},
+			inputs: []testLibrary{
+				{"a.lib", []testMember{{"a.o", testObject{defines: []string{"f"}}}}},
+			},
+			members:    []string{"base.o", "f.o"},
+			unresolved: []string{"x"},
+		},
+		{
+			name:       "no input",
+			base:       base,
+			members:    []string{"base.o"},
+			unresolved: []string{"f", "g", "x"},
+		},
+	}
+	for _, test := range tests {
+		for _, semantics := range allSemantics {
+			plan := resolveTestLibraries(t, ResolverOptions{Semantics: semantics}, test.base, test.inputs...)
+			members := test.members
+			if m, ok := test.membersBySemantics[semantics]; ok {
+				members = m
+			}
+			unresolved := test.unresolved
+			if u, ok := test.unresolvedBySemantics[semantics]; ok {
+				unresolved = u
+			}
+			if got := memberLabels(plan.Members()); !reflect.DeepEqual(got, members) {
+				t.Errorf("%s (%s): members %q, want %q", test.name, semantics, got, members)
+			}
+			if got := unresolvedSymbols(plan); !reflect.DeepEqual(got, unresolved) {
+				t.Errorf("%s (%s): unresolved %q, want %q", test.name, semantics, got, unresolved)
+			}
+		}
+	}
+}
+
+func TestResolveSymbols(t *testing.T) {
+	plan := resolveTestLibraries(t, ResolverOptions{Semantics: SemanticsMSVC},
+		[]testMember{{"base.o", testObject{imports: []string{"f", "g"}}}},
+		testLibrary{"a.lib", []testMember{{"a.o", testObject{defines: []string{"f", "g", "h"}}}}})
+	if len(plan.Pulled) != 1 {
+		t.Fatalf("pulled %q", memberLabels(plan.Pulled))
+	}
+	member := plan.Pulled[0]
+	if member.Reason != PullReasonSymbol || !reflect.DeepEqual(member.Symbols, []string{"f", "g"}) {
+		t.Errorf("reason '%s', symbols %q", member.Reason, member.Symbols)
+	}
+	if len(plan.Edges) != 1 || plan.Edges[0].From != plan.Base[0] || plan.Edges[0].To != member {
+		t.Errorf("edges are wrong")
+	}
+}
+
+func TestResolveUnknownSemantics(t *testing.T) {
+	dir := t.TempDir()
+	resolver := NewResolver(ResolverOptions{
+		Bases:     []string{writeTestObject(t, dir, "base.o", testObject{imports: []string{"f"}})},
+		Semantics: "bfd",
+		Arch:      "x86_64",
+	})
+	defer resolver.Close()
+	if _, err := resolver.Resolve(context.Background()); err == nil {
+		t.Errorf("unknown semantics is accepted")
+	}
+}
+
+func pullReasons(plan *Plan) []string {
+	ret := []string{}
+	for _, member := range plan.Pulled {
+		ret = append(ret, member.Label()+" "+member.Reason)
+	}
+	return ret
+}
+
+// all members of whole archives are pulled before searching, so they define
+// symbols even if an earlier input defines them too.
+func TestResolveWholeArchive(t *testing.T) {
+	for _, semantics := range allSemantics {
+		plan := resolveTestLibraries(t, ResolverOptions{Semantics: semantics, WholeArchiveInputs: []string{"a.lib"}},
+			[]testMember{{"base.o", testObject{imports: []string{"f"}}}},
+			testLibrary{"b.lib", []testMember{
+				{"f.o", testObject{defines: []string{"f"}}},
+				{"h.o", testObject{defines: []string{"h"}}},
+			}},
+			testLibrary{"a.lib", []testMember{
+				{"a1.o", testObject{defines: []string{"f"}}},
+				{"a2.o", testObject{defines: []string{"g"}, imports: []string{"h"}}},
+			}})
+		// 'h' is referenced before 'b.lib' is searched, even with GNU ld.
+		want := []string{"a:a1.o whole-archive", "a:a2.o whole-archive", "b:h.o symbol"}
+		if got := pullReasons(plan); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: %q, want %q", semantics, got, want)
+		}
+		if got := plan.Pulled[0].Symbols; !reflect.DeepEqual(got, []string{"f"}) {
+			t.Errorf("%s: 'a:a1.o' resolves %q", semantics, got)
+		}
+	}
+}
+
+// 'a.lib' is passed before the alternate name is looked up, so GNU ld does
+// not find it.
+func TestResolveGNUAlternateName(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("Mach-O has no '/ALTERNATENAME'")
+	}
+	base := []testMember{{"base.o", testObject{imports: []string{"f"}, directives: "/ALTERNATENAME:f=f_default"}}}
+	inputs := []testLibrary{
+		{"a.lib", []testMember{{"default.o", testObject{defines: []string{"f_default"}}}}},
+		{"b.lib", []testMember{{"g.o", testObject{defines: []string{"g"}}}}},
+	}
+	tests := []struct {
+		semantics  string
+		pulled     []string
+		unresolved []string
+	}{
+		{SemanticsGNU, []string{}, []string{"f", "f_default"}},
+		{SemanticsGNUGroup, []string{"a:default.o"}, []string{}},
+		{SemanticsMSVC, []string{"a:default.o"}, []string{}},
+	}
+	for _, test := range tests {
+		plan := resolveTestLibraries(t, ResolverOptions{Semantics: test.semantics}, base, inputs...)
+		if got := memberLabels(plan.Pulled); !reflect.DeepEqual(got, test.pulled) {
+			t.Errorf("%s: pulled %q, want %q", test.semantics, got, test.pulled)
+		}
+		if got := unresolvedSymbols(plan); !reflect.DeepEqual(got, test.unresolved) {
+			t.Errorf("%s: unresolved %q, want %q", test.semantics, got, test.unresolved)
+		}
+	}
+}
+
+// bases are libraries or object files, and symbols defined by any of them
+// are not looked up in inputs.
+func TestResolveMultipleBases(t *testing.T) {
+	dir := t.TempDir()
+	plan := resolveTest(t, ResolverOptions{
+		Bases: []string{
+			writeTestLibrary(t, dir, "base.lib", []testMember{{"a.o", testObject{defines: []string{"f"}, imports: []string{"g", "h"}}}}),
+			writeTestObject(t, dir, "b.o", testObject{defines: []string{"g", "dup"}}),
+			writeTestObject(t, dir, "c.o", testObject{defines: []string{"dup"}}),
+		},
+		Inputs: []string{
+			writeTestLibrary(t, dir, "in.lib", []testMember{
+				{"g.o", testObject{defines: []string{"g"}}},
+				{"h.o", testObject{defines: []string{"h"}}},
+			}),
+		},
+		Semantics: SemanticsMSVC,
+		Arch:      "x86_64",
+	})
+	if got, want := memberLabels(plan.Members()), []string{"a.o", "b.o", "c.o", "in:h.o"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("members %q, want %q", got, want)
+	}
+	if len(plan.Duplicates) != 1 || plan.Duplicates[0].Name != "dup" || !reflect.DeepEqual(memberLabels(plan.Duplicates[0].Members), []string{"b.o", "c.o"}) {
+		t.Errorf("duplicates are wrong")
+	}
+}
+
+func TestIsArchiveFile(t *testing.T) {
+	dir := t.TempDir()
+	fat := []byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 0}
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"lib.a", []byte("!<arch>\n"), true},
+		{"x.o", testObject{}.bytes(), false},
+		{"fat.a", fat, true},
+		{"fat.o", fat, false},
+		{"empty.o", []byte{}, false},
+	}
+	for _, test := range tests {
+		filePath := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(filePath, test.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := IsArchiveFile(filePath); err != nil || got != test.want {
+			t.Errorf("%s: %v, %v", test.name, got, err)
+		}
+	}
+	if _, err := IsArchiveFile(filepath.Join(dir, "nosuch.a")); err == nil {
+		t.Errorf("missing file is read")
+	}
+}
+
+func TestResolveDirectives(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("Mach-O has no '.drectve'")
+	}
+	input := testLibrary{"a.lib", []testMember{
+		{"inc.o", testObject{defines: []string{"inc"}}},
+		{"f.o", testObject{defines: []string{"f"}}},
+		{"default.o", testObject{defines: []string{"f_default"}}},
+		{"other.o", testObject{defines: []string{"f_other"}}},
+	}}
+	tests := []struct {
+		name       string
+		base       []testMember
+		pulled     []string
+		unresolved []string
+	}{
+		{
+			name:   "include",
+			base:   []testMember{{"base.o", testObject{defines: []string{"main"}, directives: "/INCLUDE:inc /INCLUDE:main"}}},
+			pulled: []string{"a:inc.o"},
+		},
+		{
+			name:       "include undefined",
+			base:       []testMember{{"base.o", testObject{directives: "-include:nosuch"}}},
+			unresolved: []string{"nosuch"},
+		},
+		{
+			// the symbol itself wins over the alternate name.
+			name:   "defined symbol",
+			base:   []testMember{{"base.o", testObject{imports: []string{"f"}, directives: "/ALTERNATENAME:f=f_default"}}},
+			pulled: []string{"a:f.o"},
+		},
+		{
+			name: "alternate name defined by base",
+			base: []testMember{
+				{"base.o", testObject{imports: []string{"g"}, directives: "/ALTERNATENAME:g=g_base"}},
+				{"g.o", testObject{defines: []string{"g_base"}}},
+			},
+		},
+		{
+			name:   "alternate name pulled",
+			base:   []testMember{{"base.o", testObject{imports: []string{"g"}, directives: "/ALTERNATENAME:g=f_default"}}},
+			pulled: []string{"a:default.o"},
+		},
+		{
+			name: "first alternate name wins",
+			base: []testMember{
+				{"base.o", testObject{imports: []string{"g"}, directives: "/ALTERNATENAME:g=f_other"}},
+				{"base2.o", testObject{defines: []string{"main"}, directives: "/ALTERNATENAME:g=f_default"}},
+			},
+			pulled: []string{"a:other.o"},
+		},
+		{
+			name:       "alternate name undefined",
+			base:       []testMember{{"base.o", testObject{imports: []string{"g"}, directives: "/ALTERNATENAME:g=nosuch"}}},
+			unresolved: []string{"g", "nosuch"},
+		},
+	}
+	for _, test := range tests {
+		plan := resolveTestLibraries(t, ResolverOptions{Semantics: SemanticsMSVC}, test.base, input)
+		pulled, unresolved := test.pulled, test.unresolved
+		if pulled == nil {
+			pulled = []string{}
+		}
+		if unresolved == nil {
+			unresolved = []string{}
+		}
+		if got := memberLabels(plan.Pulled); !reflect.DeepEqual(got, pulled) {
+			t.Errorf("%s: pulled %q, want %q", test.name, got, pulled)
+		}
+		if got := unresolvedSymbols(plan); !reflect.DeepEqual(got, unresolved) {
+			t.Errorf("%s: unresolved %q, want %q", test.name, got, unresolved)
+		}
+	}
+}
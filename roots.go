@@ -0,0 +1,159 @@
+package catlib
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ReadRootSymbolsFile reads symbols the output has to provide. The file is
+// either a module-definition (.def) file, or a list such as a Mach-O exported
+// symbols list, one symbol or wildcard pattern per line.
+func ReadRootSymbolsFile(filePath string) ([]string, error) {
+	if strings.ToLower(filepath.Ext(filePath)) == ".def" {
+		return readModuleDefinitionFile(filePath)
+	}
+	return ReadSymbolListFile(filePath)
+}
+
+var moduleDefinitionKeywords = []string{
+	"NAME", "LIBRARY", "DESCRIPTION", "STACKSIZE", "HEAPSIZE", "SECTIONS", "VERSION", "EXPORTS",
+}
+
+// readModuleDefinitionFile reads names of the symbols listed in EXPORTS
+// statement. For 'entryname=internalname', the internal name is returned.
+// Exports forwarded to other DLLs are ignored.
+func readModuleDefinitionFile(filePath string) ([]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := []string{}
+	exports := false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, ";"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if keyword := strings.ToUpper(fields[0]); contains(moduleDefinitionKeywords, keyword) {
+			exports = keyword == "EXPORTS"
+			fields = fields[1:]
+			if !exports || len(fields) == 0 {
+				continue
+			}
+		}
+		if !exports {
+			continue
+		}
+
+		name := strings.Trim(fields[0], "\"")
+		if i := strings.Index(name, "="); i >= 0 {
+			name = strings.Trim(name[i+1:], "\"=")
+		}
+		if name == "" || strings.Contains(name, ".") {
+			continue
+		}
+		ret = append(ret, name)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// symbolMatcher matches symbol names against symbols and wildcard patterns
+// ('*', '?' and '[...]'). A name also matches without the global leading
+// underscore of Mach-O and 32-bit COFF.
+type symbolMatcher struct {
+	names    *StringSet
+	patterns []string
+}
+
+func newSymbolMatcher(patterns []string) *symbolMatcher {
+	m := new(symbolMatcher)
+	m.names = NewStringSet()
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			m.patterns = append(m.patterns, pattern)
+		} else {
+			m.names.Put(pattern)
+		}
+	}
+	return m
+}
+
+// Match returns the symbol or the pattern matching name, or false.
+func (this *symbolMatcher) Match(name string) (string, bool) {
+	for _, n := range symbolNameCandidates(name) {
+		if this.names.Has(n) {
+			return n, true
+		}
+		for _, pattern := range this.patterns {
+			if ok, _ := path.Match(pattern, n); ok {
+				return pattern, true
+			}
+		}
+	}
+	return "", false
+}
+
+// pruneBase drops base members unreachable from the root symbols. Members
+// with static initializers but no exported symbols are kept.
+func pruneBase(members []*PlanMember, roots []string) (kept, dropped []*PlanMember, unmatched []string) {
+	matcher := newSymbolMatcher(roots)
+	matched := NewStringSet()
+
+	definedBy := make(map[string]*PlanMember)
+	reachable := make(map[*PlanMember]bool)
+	worklist := []*PlanMember{}
+	for _, member := range members {
+		root := len(member.Exports) == 0 && HasInitializer(member.lib.Sections(member.Index))
+		for _, sym := range member.Exports {
+			if _, ok := definedBy[sym]; !ok {
+				definedBy[sym] = member
+			}
+			if pattern, ok := matcher.Match(sym); ok {
+				matched.Put(pattern)
+				root = true
+			}
+		}
+		if root && !reachable[member] {
+			reachable[member] = true
+			worklist = append(worklist, member)
+		}
+	}
+
+	for len(worklist) > 0 {
+		member := worklist[0]
+		worklist = worklist[1:]
+		for _, sym := range member.Imports {
+			if to, ok := definedBy[sym]; ok && !reachable[to] {
+				reachable[to] = true
+				worklist = append(worklist, to)
+			}
+		}
+	}
+
+	for _, member := range members {
+		if reachable[member] {
+			kept = append(kept, member)
+		} else {
+			dropped = append(dropped, member)
+		}
+	}
+	for _, root := range roots {
+		if !matched.Has(root) {
+			unmatched = append(unmatched, root)
+		}
+	}
+	return kept, dropped, unmatched
+}
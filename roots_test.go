@@ -0,0 +1,97 @@
+package catlib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadRootSymbolsFile(t *testing.T) {
+	dir := t.TempDir()
+	def := `LIBRARY zlib ; comment
+EXPORTS adler32
+    inflate
+    deflate @1
+    compress=zcompress PRIVATE
+    "quoted"
+    Sleep=kernel32.Sleep
+SECTIONS
+    .text READ
+EXPORTS
+    crc32 DATA
+`
+	list := "# exported symbols list\n_inflate\n_deflate*\n"
+	tests := []struct {
+		name     string
+		contents string
+		want     []string
+	}{
+		{"zlib.def", def, []string{"adler32", "inflate", "deflate", "zcompress", "quoted", "crc32"}},
+		{"ZLIB.DEF", def, []string{"adler32", "inflate", "deflate", "zcompress", "quoted", "crc32"}},
+		{"exported.txt", list, []string{"_inflate", "_deflate*"}},
+	}
+	for _, test := range tests {
+		filePath := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(filePath, []byte(test.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadRootSymbolsFile(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSymbolMatcher(t *testing.T) {
+	m := newSymbolMatcher([]string{"inflate", "deflate*", "crc3?", "_adler[0-9]*"})
+	tests := []struct {
+		name  string
+		match string
+	}{
+		{"inflate", "inflate"},
+		{"_inflate", "inflate"},
+		{"deflateInit_", "deflate*"},
+		{"_deflate", "deflate*"},
+		{"crc32", "crc3?"},
+		{"_adler32", "_adler[0-9]*"},
+		{"adler32", ""},
+		{"inflateEnd", ""},
+		{"__inflate", ""},
+	}
+	for _, test := range tests {
+		match, ok := m.Match(test.name)
+		if ok != (test.match != "") || match != test.match {
+			t.Errorf("%s: '%s', %v", test.name, match, ok)
+		}
+	}
+}
+
+// base members unreachable from the roots are dropped, except ones which
+// have static initializers only.
+func TestResolveRoots(t *testing.T) {
+	base := []testMember{
+		{"api.o", testObject{defines: []string{"api"}, imports: []string{"impl"}}},
+		{"impl.o", testObject{defines: []string{"impl"}, imports: []string{"f"}}},
+		{"unused.o", testObject{defines: []string{"unused"}, imports: []string{"g"}}},
+		{"ex.o", testObject{defines: []string{"ex_one"}}},
+		{"init.o", testObject{sections: []string{testInitializerSection()}}},
+	}
+	input := testLibrary{"a.lib", []testMember{
+		{"f.o", testObject{defines: []string{"f"}}},
+		{"g.o", testObject{defines: []string{"g"}}},
+	}}
+	plan := resolveTestLibraries(t, ResolverOptions{Semantics: SemanticsMSVC, Roots: []string{"api", "ex_*", "nomatch"}}, base, input)
+	if got, want := memberLabels(plan.Members()), []string{"api.o", "impl.o", "ex.o", "init.o", "a:f.o"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("members %q, want %q", got, want)
+	}
+	if got := memberLabels(plan.DroppedBase); !reflect.DeepEqual(got, []string{"unused.o"}) {
+		t.Errorf("dropped %q", got)
+	}
+	if !reflect.DeepEqual(plan.UnmatchedRoots, []string{"nomatch"}) {
+		t.Errorf("unmatched %q", plan.UnmatchedRoots)
+	}
+}
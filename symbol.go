@@ -4,4 +4,7 @@ type ISymbol interface {
 	Name() string
 	IsImportSymbol() bool
 	IsExportSymbol() bool
+	// true for definitions which can be overridden or merged, such as weak
+	// definitions and COMDATs.
+	IsWeak() bool
 }
@@ -4,6 +4,7 @@ type Symbol struct {
 	ISymbol
 	name      string
 	undefined bool
+	weak      bool
 }
 
 func NewSymbol(name string, undefined bool) Symbol {
@@ -24,3 +25,7 @@ func (this *Symbol) IsImportSymbol() bool {
 func (this *Symbol) IsExportSymbol() bool {
 	return !this.undefined
 }
+
+func (this *Symbol) IsWeak() bool {
+	return this.weak
+}
@@ -7,6 +7,10 @@ import (
 type Symbol struct {
 	ISymbol
 	symbol *pe.Symbol
+	// defined in a COMDAT section.
+	comdat bool
+	// weak external, whose default symbol is defined in the object.
+	weakDefinition bool
 }
 
 func NewSymbol(symbol *pe.Symbol) Symbol {
@@ -20,9 +24,13 @@ func (this *Symbol) IsImportSymbol() bool {
 }
 
 func (this *Symbol) IsExportSymbol() bool {
-	return this.symbol.StorageClass == IMAGE_SYM_CLASS_EXTERNAL && (this.symbol.Value != 0 || this.symbol.SectionNumber != 0)
+	return this.weakDefinition || (this.symbol.StorageClass == IMAGE_SYM_CLASS_EXTERNAL && (this.symbol.Value != 0 || this.symbol.SectionNumber != 0))
 }
 
 func (this *Symbol) Name() string {
 	return this.symbol.Name
 }
+
+func (this *Symbol) IsWeak() bool {
+	return this.comdat || this.symbol.StorageClass == IMAGE_SYM_CLASS_WEAK_EXTERNAL
+}
@@ -0,0 +1,35 @@
+package catlib
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// ReadSymbolListFile reads a list of symbol names, one symbol per line.
+// Blank lines and everything after '#' are ignored.
+func ReadSymbolListFile(filePath string) ([]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := []string{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,27 @@
+package catlib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadSymbolListFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "symbols.txt")
+	contents := "# kept global\n_f\n\n  _g  # referenced by the host\n\t\n_h"
+	if err := ioutil.WriteFile(filePath, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	symbols, err := ReadSymbolListFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"_f", "_g", "_h"}; !reflect.DeepEqual(symbols, want) {
+		t.Errorf("%q, want %q", symbols, want)
+	}
+
+	if _, err := ReadSymbolListFile(filepath.Join(t.TempDir(), "nosuch.txt")); err == nil {
+		t.Errorf("missing file is read")
+	}
+}
@@ -0,0 +1,170 @@
+package catlib
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// testObject is a synthetic object file, which defines and references
+// symbols.
+type testObject struct {
+	defines []string
+	imports []string
+	// extra data sections, such as initializer sections.
+	sections []string
+	// contents of '.drectve' section (COFF only).
+	directives string
+}
+
+type testMember struct {
+	name   string
+	object testObject
+}
+
+// bytes returns the object in the format LibFile of the host reads: Mach-O
+// on macOS, where members are read by nm and libtool, and COFF otherwise.
+func (this testObject) bytes() []byte {
+	if runtime.GOOS == "darwin" {
+		return this.machO()
+	}
+	return this.coff()
+}
+
+func (this testObject) coff() []byte {
+	obj := &COFFObject{Machine: 0x8664}
+	text := &COFFSection{Name: ".text", Data: []byte{0xc3}, Characteristics: 0x60500020}
+	obj.Sections = append(obj.Sections, text)
+	for _, name := range this.sections {
+		obj.Sections = append(obj.Sections, &COFFSection{Name: name, Data: make([]byte, 8), Characteristics: 0x40300040})
+	}
+	if this.directives != "" {
+		obj.Sections = append(obj.Sections, &COFFSection{Name: ".drectve", Data: []byte(this.directives), Characteristics: 0x00100a00})
+	}
+	for _, name := range this.defines {
+		obj.Symbols = append(obj.Symbols, &COFFSymbol{Name: name, Section: text, Type: 0x20, StorageClass: IMAGE_SYM_CLASS_EXTERNAL})
+	}
+	for _, name := range this.imports {
+		sym := &COFFSymbol{Name: name, Type: 0x20, StorageClass: IMAGE_SYM_CLASS_EXTERNAL}
+		obj.Symbols = append(obj.Symbols, sym)
+		text.Relocations = append(text.Relocations, &COFFRelocation{Symbol: sym, Type: 4})
+	}
+	data, err := obj.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// machO returns an x86_64 Mach-O object, which has a segment of '__text'
+// and the extra sections, and a symbol table.
+func (this testObject) machO() []byte {
+	type section struct {
+		name    string
+		segment string
+		data    []byte
+		flags   uint32
+	}
+	sections := []section{{"__text", "__TEXT", []byte{0xc3}, 0x80000400}}
+	for _, name := range this.sections {
+		var flags uint32
+		if name == "__mod_init_func" {
+			flags = 0x9
+		}
+		sections = append(sections, section{name, "__DATA", make([]byte, 8), flags})
+	}
+
+	order := binary.LittleEndian
+	segmentSize := 72 + 80*len(sections)
+	sizeofcmds := segmentSize + 24
+	dataOffset := 32 + sizeofcmds
+	data := make([]byte, dataOffset)
+	for _, s := range sections {
+		data = append(data, s.data...)
+	}
+	symoff := len(data)
+
+	strtab := []byte{0}
+	nlist := func(name string, ntype byte, sect byte) []byte {
+		entry := make([]byte, 16)
+		order.PutUint32(entry[0:], uint32(len(strtab)))
+		entry[4] = ntype
+		entry[5] = sect
+		strtab = append(append(strtab, name...), 0)
+		return entry
+	}
+	for _, name := range this.defines {
+		data = append(data, nlist(name, machoN_SECT|machoN_EXT, 1)...)
+	}
+	for _, name := range this.imports {
+		data = append(data, nlist(name, machoN_UNDF|machoN_EXT, 0)...)
+	}
+	stroff := len(data)
+	data = append(data, strtab...)
+
+	order.PutUint32(data[0:], machoMagic64)
+	order.PutUint32(data[4:], 0x01000007)
+	order.PutUint32(data[8:], 3)
+	order.PutUint32(data[12:], 1)
+	order.PutUint32(data[16:], 2)
+	order.PutUint32(data[20:], uint32(sizeofcmds))
+
+	segment := data[32:]
+	order.PutUint32(segment[0:], 0x19)
+	order.PutUint32(segment[4:], uint32(segmentSize))
+	order.PutUint64(segment[32:], uint64(symoff-dataOffset))
+	order.PutUint64(segment[40:], uint64(dataOffset))
+	order.PutUint64(segment[48:], uint64(symoff-dataOffset))
+	order.PutUint32(segment[56:], 7)
+	order.PutUint32(segment[60:], 7)
+	order.PutUint32(segment[64:], uint32(len(sections)))
+	offset := dataOffset
+	for i, s := range sections {
+		header := segment[72+80*i:]
+		copy(header[0:16], s.name)
+		copy(header[16:32], s.segment)
+		order.PutUint64(header[32:], uint64(offset-dataOffset))
+		order.PutUint64(header[40:], uint64(len(s.data)))
+		order.PutUint32(header[48:], uint32(offset))
+		order.PutUint32(header[64:], s.flags)
+		offset += len(s.data)
+	}
+
+	symtab := data[32+segmentSize:]
+	order.PutUint32(symtab[0:], machoLC_SYMTAB)
+	order.PutUint32(symtab[4:], 24)
+	order.PutUint32(symtab[8:], uint32(symoff))
+	order.PutUint32(symtab[12:], uint32(len(this.defines)+len(this.imports)))
+	order.PutUint32(symtab[16:], uint32(stroff))
+	order.PutUint32(symtab[20:], uint32(len(strtab)))
+	return data
+}
+
+// writeTestLibrary writes a static library of the members into dir, in the
+// format native to them.
+func writeTestLibrary(t *testing.T, dir string, name string, members []testMember) string {
+	archiveMembers := []ArchiveMember{}
+	for _, m := range members {
+		archiveMembers = append(archiveMembers, ArchiveMember{m.name, m.object.bytes()})
+	}
+	data, err := WriteArchive(archiveMembers, DefaultArchiveFormat(archiveMembers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+// writeTestObject writes an object file into dir.
+func writeTestObject(t *testing.T, dir string, name string, object testObject) string {
+	filePath := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filePath, object.bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
@@ -0,0 +1,230 @@
+package catlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// symbols provided by C/C++ runtime libraries.
+	UnresolvedClassRuntime = "runtime"
+	// symbols provided by OS libraries, or imported from DLLs.
+	UnresolvedClassOS = "os"
+	// symbols of a member which keeps '-defaultlib' libraries other than
+	// runtime ones. The libraries are not read, so the symbols are only
+	// expected, not known, to be provided by them.
+	UnresolvedClassDefaultLib = "defaultlib"
+	// symbols nobody is expected to provide.
+	UnresolvedClassMissing = "missing"
+)
+
+type UnresolvedSymbol struct {
+	Name  string `json:"name"`
+	Class string `json:"class"`
+	// kept '-defaultlib' libraries, which are expected to provide the symbol.
+	Libraries []string `json:"libraries,omitempty"`
+}
+
+type UnresolvedMember struct {
+	Library string             `json:"library"`
+	Member  string             `json:"member"`
+	Symbols []UnresolvedSymbol `json:"symbols"`
+}
+
+type UnresolvedReport struct {
+	Members []UnresolvedMember `json:"members"`
+}
+
+var (
+	runtimeSymbolPrefixes = []string{
+		// MSVC runtime
+		"__security_", "__GSHandlerCheck", "__chkstk", "_RTC_", "__CxxFrameHandler", "_CxxThrowException",
+		"__std_", "_purecall", "__RTDynamicCast", "__RTtypeid", "_Init_thread_", "_tls_", "__acrt_",
+		"__stdio_common_", "__vcrt_", "__C_specific_handler", "_fltused", "_Mtx_", "_Cnd_", "_Thrd_",
+		"__report_rangecheckfailure", "__local_stdio_", "_errno", "__dyn_tls_", "__scrt_",
+		"??2@", "??3@", "??_U@", "??_V@", "??_7type_info@@", "?_X", "_Query_perf_",
+		// Itanium C++ ABI runtime
+		"__cxa_", "__gxx_personality", "_Unwind_", "_ZTVN10__cxxabiv", "_ZNSt", "_ZNKSt", "_ZSt",
+		"_Znw", "_Zna", "_ZdlPv", "_ZdaPv", "__stack_chk_", "__dso_handle", "__tls_get_addr",
+		"dyld_stub_binder", "objc_", "_objc_", "__objc_", "swift_",
+	}
+	runtimeSymbolNames = []string{
+		"abort", "atexit", "exit", "_exit", "malloc", "calloc", "realloc", "free", "memcpy", "memmove",
+		"memset", "memcmp", "memchr", "strlen", "strcmp", "strncmp", "strcpy", "strncpy", "strcat",
+		"strncat", "strchr", "strrchr", "strstr", "strtol", "strtoul", "strtoll", "strtoull", "strtod",
+		"strtof", "atoi", "atol", "atof", "qsort", "bsearch", "printf", "fprintf", "sprintf", "snprintf",
+		"vprintf", "vfprintf", "vsprintf", "vsnprintf", "puts", "fputs", "fputc", "putchar", "fopen",
+		"fclose", "fread", "fwrite", "fseek", "ftell", "fflush", "fgets", "fgetc", "getenv", "time",
+		"clock", "localtime", "gmtime", "strftime", "rand", "srand", "setjmp", "longjmp", "toupper",
+		"tolower", "isalpha", "isdigit", "isspace", "sqrt", "pow", "exp", "log", "log10", "sin", "cos",
+		"tan", "floor", "ceil", "fabs", "fmod", "stdin", "stdout", "stderr", "__stdinp", "__stdoutp",
+		"__stderrp", "__errno_location", "__error", "__assert_fail", "__assert_rtn", "_assert", "_wassert",
+	}
+	// macOS frameworks and system libraries, without the leading underscore.
+	machoOSSymbolPrefixes = []string{
+		"OBJC_CLASS_$_NS", "OBJC_CLASS_$_UI", "OBJC_METACLASS_$_NS", "OBJC_METACLASS_$_UI", "kCF", "CF",
+		"CG", "CT", "NS", "UI", "Sec", "mach_", "dispatch_", "os_log", "os_unfair_lock", "xpc_",
+	}
+	osSymbolPrefixes = []string{
+		"pthread_", "sem_", "shm_", "sched_", "clock_gettime", "gettimeofday", "nanosleep", "usleep",
+		"dlopen", "dlsym", "dlclose", "dlerror",
+	}
+	osSymbolNames = []string{
+		"open", "close", "read", "write", "lseek", "stat", "fstat", "lstat", "unlink", "rename", "mkdir",
+		"rmdir", "opendir", "readdir", "closedir", "mmap", "munmap", "mprotect", "getpid", "fork",
+		"execve", "waitpid", "kill", "signal", "sigaction", "socket", "bind", "listen", "accept",
+		"connect", "send", "recv", "sendto", "recvfrom", "select", "poll", "getaddrinfo", "freeaddrinfo",
+		"sysconf", "ioctl", "fcntl", "isatty", "getcwd", "chdir", "access", "sysctl", "sysctlbyname",
+	}
+	// default libraries of C/C++ runtime, which are expected to be kept.
+	runtimeLibraryNames = []string{
+		"libcmt", "libcmtd", "msvcrt", "msvcrtd", "oldnames", "libcpmt", "libcpmtd", "msvcprt",
+		"msvcprtd", "libvcruntime", "libvcruntimed", "vcruntime", "vcruntimed", "libucrt", "libucrtd",
+		"ucrt", "ucrtd", "libconcrt", "libconcrtd", "concrt", "concrtd", "uuid",
+	}
+)
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// symbol name candidates, with and without the global leading underscore of
+// Mach-O and 32-bit COFF.
+func symbolNameCandidates(name string) []string {
+	ret := []string{name}
+	if strings.HasPrefix(name, "_") {
+		ret = append(ret, name[1:])
+	}
+	return ret
+}
+
+// ClassifyUnresolvedSymbol classifies an undefined symbol. keptDefaultLibs
+// are '-defaultlib' libraries kept in the member referencing the symbol.
+func ClassifyUnresolvedSymbol(name string, keptDefaultLibs []string) UnresolvedSymbol {
+	ret := UnresolvedSymbol{Name: name}
+
+	importName := strings.TrimPrefix(name, "__imp_")
+	for _, n := range symbolNameCandidates(importName) {
+		if hasAnyPrefix(n, runtimeSymbolPrefixes) || contains(runtimeSymbolNames, n) || strings.Contains(n, "@std@@") {
+			ret.Class = UnresolvedClassRuntime
+			return ret
+		}
+	}
+	if strings.HasPrefix(name, "__imp_") || (strings.HasPrefix(name, "_") && hasAnyPrefix(name[1:], machoOSSymbolPrefixes)) {
+		ret.Class = UnresolvedClassOS
+		return ret
+	}
+	for _, n := range symbolNameCandidates(name) {
+		if hasAnyPrefix(n, osSymbolPrefixes) || contains(osSymbolNames, n) {
+			ret.Class = UnresolvedClassOS
+			return ret
+		}
+	}
+
+	for _, lib := range keptDefaultLibs {
+		if !contains(runtimeLibraryNames, lib) {
+			ret.Libraries = append(ret.Libraries, lib)
+		}
+	}
+	if len(ret.Libraries) > 0 {
+		ret.Class = UnresolvedClassDefaultLib
+	} else {
+		ret.Class = UnresolvedClassMissing
+	}
+	return ret
+}
+
+// UnresolvedReport reports symbols still undefined after resolution, grouped
+// by members referencing them. keptDefaultLibs are '-defaultlib' libraries
+// kept in each member.
+func (this *Plan) UnresolvedReport(keptDefaultLibs map[*PlanMember][]string) *UnresolvedReport {
+	unresolved := NewStringSet()
+	for _, sym := range this.Unresolved {
+		unresolved.Put(sym)
+	}
+
+	ret := new(UnresolvedReport)
+	ret.Members = []UnresolvedMember{}
+	for _, member := range this.Members() {
+		symbols := []UnresolvedSymbol{}
+		for _, sym := range member.Imports {
+			if unresolved.Has(sym) {
+				symbols = append(symbols, ClassifyUnresolvedSymbol(sym, keptDefaultLibs[member]))
+			}
+		}
+		if len(symbols) > 0 {
+			ret.Members = append(ret.Members, UnresolvedMember{member.Library, member.Name, symbols})
+		}
+	}
+	return ret
+}
+
+// Disallowed returns names of symbols in 'missing' or 'defaultlib' class,
+// which are not in allowlist. 'defaultlib' symbols are included because a
+// kept library may not define them. An allowlist entry ending with '*'
+// matches symbols by prefix.
+func (this *UnresolvedReport) Disallowed(allowlist []string) []string {
+	ret := NewStringSet()
+	for _, member := range this.Members {
+		for _, sym := range member.Symbols {
+			if sym.Class != UnresolvedClassMissing && sym.Class != UnresolvedClassDefaultLib {
+				continue
+			}
+			allowed := false
+			for _, pattern := range allowlist {
+				if sym.Name == pattern || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(sym.Name, strings.TrimSuffix(pattern, "*"))) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				ret.Put(sym.Name)
+			}
+		}
+	}
+	return ret.SortedValues()
+}
+
+func (this *UnresolvedReport) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+func (this *UnresolvedReport) WriteText(w io.Writer) error {
+	for _, member := range this.Members {
+		if _, err := fmt.Fprintf(w, "%s:%s\n", filepath.Base(member.Library), member.Member); err != nil {
+			return err
+		}
+		for _, sym := range member.Symbols {
+			class := sym.Class
+			if len(sym.Libraries) > 0 {
+				class = fmt.Sprintf("%s:%s", class, strings.Join(sym.Libraries, ","))
+			}
+			if _, err := fmt.Fprintf(w, "  %-10s %s\n", class, sym.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package catlib
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestClassifyUnresolvedSymbol(t *testing.T) {
+	tests := []struct {
+		name            string
+		keptDefaultLibs []string
+		class           string
+		libraries       []string
+	}{
+		{"malloc", nil, UnresolvedClassRuntime, nil},
+		{"_malloc", nil, UnresolvedClassRuntime, nil},
+		{"__imp_malloc", nil, UnresolvedClassRuntime, nil},
+		{"__security_cookie", nil, UnresolvedClassRuntime, nil},
+		{"??2@YAPEAX_K@Z", nil, UnresolvedClassRuntime, nil},
+		{"?_Xlength_error@std@@YAXPEBD@Z", nil, UnresolvedClassRuntime, nil},
+		{"__ZNSt3__14coutE", nil, UnresolvedClassRuntime, nil},
+		{"__imp_CreateFileW", nil, UnresolvedClassOS, nil},
+		{"_CFRelease", nil, UnresolvedClassOS, nil},
+		{"pthread_create", nil, UnresolvedClassOS, nil},
+		{"_open", nil, UnresolvedClassOS, nil},
+		{"inflate", nil, UnresolvedClassMissing, nil},
+		{"inflate", []string{"libcmt", "oldnames"}, UnresolvedClassMissing, nil},
+		{"inflate", []string{"libcmt", "zlib"}, UnresolvedClassDefaultLib, []string{"zlib"}},
+		// runtime symbols are not expected from kept libraries.
+		{"malloc", []string{"zlib"}, UnresolvedClassRuntime, nil},
+	}
+	for _, test := range tests {
+		got := ClassifyUnresolvedSymbol(test.name, test.keptDefaultLibs)
+		want := UnresolvedSymbol{test.name, test.class, test.libraries}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s %q: %+v, want %+v", test.name, test.keptDefaultLibs, got, want)
+		}
+	}
+}
+
+func testUnresolvedReport() *UnresolvedReport {
+	plan := testPlan()
+	plan.Base[0].Imports = append(plan.Base[0].Imports, "malloc", "deflate")
+	plan.Pulled[1].Imports = []string{"zlib_helper", "z_verbose"}
+	plan.Unresolved = []string{"deflate", "malloc", "z_verbose", "zlib_helper"}
+	return plan.UnresolvedReport(map[*PlanMember][]string{plan.Pulled[1]: {"libcmt", "zhelper"}})
+}
+
+func TestUnresolvedReport(t *testing.T) {
+	report := testUnresolvedReport()
+	want := []UnresolvedMember{
+		{"/work/base.lib", "base.o", []UnresolvedSymbol{
+			{"malloc", UnresolvedClassRuntime, nil},
+			{"deflate", UnresolvedClassMissing, nil},
+		}},
+		{"/work/z.lib", "zutil.o", []UnresolvedSymbol{
+			{"zlib_helper", UnresolvedClassDefaultLib, []string{"zhelper"}},
+			{"z_verbose", UnresolvedClassDefaultLib, []string{"zhelper"}},
+		}},
+	}
+	if !reflect.DeepEqual(report.Members, want) {
+		t.Errorf("%+v, want %+v", report.Members, want)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := "base.lib:base.o\n" +
+		"  runtime    malloc\n" +
+		"  missing    deflate\n" +
+		"z.lib:zutil.o\n" +
+		"  defaultlib:zhelper zlib_helper\n" +
+		"  defaultlib:zhelper z_verbose\n"
+	if got := buf.String(); got != text {
+		t.Errorf("got:\n%s\nwant:\n%s", got, text)
+	}
+}
+
+func TestUnresolvedReportDisallowed(t *testing.T) {
+	report := testUnresolvedReport()
+	tests := []struct {
+		allowlist  []string
+		disallowed []string
+	}{
+		{nil, []string{"deflate", "z_verbose", "zlib_helper"}},
+		{[]string{"deflate"}, []string{"z_verbose", "zlib_helper"}},
+		{[]string{"z*"}, []string{"deflate"}},
+		{[]string{"zlib_*", "deflate"}, []string{"z_verbose"}},
+		// '*' matches only at the end.
+		{[]string{"*_verbose", "zlib"}, []string{"deflate", "z_verbose", "zlib_helper"}},
+		{[]string{"*"}, []string{}},
+	}
+	for _, test := range tests {
+		if got := report.Disallowed(test.allowlist); !reflect.DeepEqual(got, test.disallowed) {
+			t.Errorf("%q: %q, want %q", test.allowlist, got, test.disallowed)
+		}
+	}
+}
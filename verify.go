@@ -0,0 +1,485 @@
+package catlib
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VerifyArchive checks integrity of a static library: member headers and
+// their padding, the long name table, that symbol tables ('/', '/SYM64/' and
+// '__.SYMDEF') match symbols defined by each member, and that every member
+// is a valid object file. It returns the problems found, or an error when
+// the file is not a static library. Slices of universal binaries are
+// verified one by one.
+func VerifyArchive(filePath string) ([]string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	slices, err := readUniversalSlices(data)
+	if err != nil {
+		return nil, err
+	}
+	if slices == nil {
+		return verifyArchiveData(data)
+	}
+	ret := []string{}
+	for _, slice := range slices {
+		problems, err := verifyArchiveData(slice.data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", slice.arch, err)
+		}
+		for _, problem := range problems {
+			ret = append(ret, fmt.Sprintf("%s: %s", slice.arch, problem))
+		}
+	}
+	return ret, nil
+}
+
+type archiveVerifier struct {
+	problems []string
+	members  []*verifiedMember
+	indices  []*archiveIndex
+	// member offsets listed in the second linker member of COFF archives.
+	coffOffsets []int
+}
+
+type verifiedMember struct {
+	name   string
+	offset int
+	data   []byte
+	object objectInfo
+	// false when the symbols are not known, and not checked against
+	// symbol tables.
+	readable bool
+}
+
+// archiveIndex is a symbol table, which maps symbols to offsets of member
+// headers.
+type archiveIndex struct {
+	name    string
+	entries []archiveIndexEntry
+}
+
+type archiveIndexEntry struct {
+	symbol string
+	offset int
+}
+
+func (this *verifiedMember) label() string {
+	return fmt.Sprintf("'%s' at offset %d", this.name, this.offset)
+}
+
+func (this *archiveVerifier) addf(format string, args ...interface{}) {
+	this.problems = append(this.problems, fmt.Sprintf(format, args...))
+}
+
+func verifyArchiveData(data []byte) ([]string, error) {
+	if bytes.HasPrefix(data, []byte("!<thin>\n")) {
+		return nil, fmt.Errorf("thin archives are not supported")
+	}
+	if !bytes.HasPrefix(data, []byte("!<arch>\n")) {
+		return nil, fmt.Errorf("not a static library")
+	}
+	v := new(archiveVerifier)
+	v.problems = []string{}
+	v.readMembers(data)
+	v.verifyIndices()
+	return v.problems, nil
+}
+
+func (this *archiveVerifier) readMembers(data []byte) {
+	var longNames []byte
+	linkerMembers := 0
+	offset := 8
+	for offset < len(data) {
+		if offset+60 > len(data) {
+			this.addf("member header at offset %d is truncated", offset)
+			return
+		}
+		header := data[offset : offset+60]
+		if string(header[58:60]) != "`\n" {
+			this.addf("member header at offset %d is not terminated by '`\\n'", offset)
+			return
+		}
+		fields := []struct {
+			name  string
+			value []byte
+			base  int
+		}{{"date", header[16:28], 10}, {"uid", header[28:34], 10}, {"gid", header[34:40], 10}, {"mode", header[40:48], 8}}
+		for _, field := range fields {
+			if value := strings.TrimSpace(string(field.value)); value != "" {
+				if _, err := strconv.ParseInt(value, field.base, 64); err != nil {
+					this.addf("member header at offset %d has invalid %s '%s'", offset, field.name, value)
+				}
+			}
+		}
+		sizeField := strings.TrimSpace(string(header[48:58]))
+		size, err := strconv.Atoi(sizeField)
+		if err != nil || size < 0 {
+			this.addf("member header at offset %d has invalid size '%s'", offset, sizeField)
+			return
+		}
+		if offset+60+size > len(data) {
+			this.addf("member at offset %d has %d bytes, but the file has %d bytes left", offset, size, len(data)-offset-60)
+			return
+		}
+		contents := data[offset+60 : offset+60+size]
+		headerOffset := offset
+		offset += 60 + size
+		if size%2 != 0 {
+			if offset == len(data) {
+				this.addf("member at offset %d has no padding at the end of file", headerOffset)
+			} else if data[offset] != '\n' {
+				this.addf("member at offset %d is padded with 0x%02x instead of '\\n'", headerOffset, data[offset])
+			}
+			offset++
+		}
+
+		name := strings.TrimRight(string(header[0:16]), " ")
+		switch {
+		case name == "/" || name == "/SYM64/":
+			if len(this.members) > 0 {
+				this.addf("symbol table '%s' at offset %d follows members", name, headerOffset)
+			}
+			linkerMembers++
+			if name == "/SYM64/" {
+				this.readGNUIndex(name, contents, 8)
+			} else if linkerMembers == 1 {
+				this.readGNUIndex(name, contents, 4)
+			} else {
+				this.readCOFFIndex(contents)
+			}
+			continue
+		case name == "//":
+			if longNames != nil {
+				this.addf("long name table at offset %d is not the first one", headerOffset)
+			}
+			longNames = contents
+			continue
+		case strings.HasPrefix(name, "/<"):
+			continue
+		case strings.HasPrefix(name, "#1/"):
+			n, err := strconv.Atoi(name[3:])
+			if err != nil || n < 0 || n > len(contents) {
+				this.addf("member at offset %d has invalid name '%s'", headerOffset, name)
+				continue
+			}
+			name = string(bytes.TrimRight(contents[:n], "\x00"))
+			contents = contents[n:]
+		case strings.HasPrefix(name, "/"):
+			n, err := strconv.Atoi(name[1:])
+			switch {
+			case err != nil || n < 0:
+				this.addf("member at offset %d has invalid name '%s'", headerOffset, name)
+				continue
+			case longNames == nil:
+				this.addf("member at offset %d has name '%s', but no long name table precedes it", headerOffset, name)
+				continue
+			case n >= len(longNames):
+				this.addf("member at offset %d has name '%s' out of the long name table of %d bytes", headerOffset, name, len(longNames))
+				continue
+			case n > 0 && longNames[n-1] != '\n' && longNames[n-1] != 0:
+				this.addf("member at offset %d has name '%s', which is not the start of a long name", headerOffset, name)
+			case bytes.IndexAny(longNames[n:], "\n\x00") < 0:
+				this.addf("member at offset %d has name '%s', which is not terminated in the long name table", headerOffset, name)
+			}
+			name = archiveLongName(longNames[n:])
+		default:
+			name = strings.TrimSuffix(name, "/")
+		}
+		if strings.HasPrefix(name, "__.SYMDEF") {
+			if len(this.members) > 0 {
+				this.addf("symbol table '%s' at offset %d follows members", name, headerOffset)
+			}
+			this.readBSDIndex(name, contents)
+			continue
+		}
+
+		m := &verifiedMember{name: name, offset: headerOffset, data: contents}
+		m.object = readObjectInfo(contents)
+		if err := verifyObject(contents); err != nil {
+			// special members like '__.LIBDEP' of GNU ar are not objects.
+			if !strings.HasPrefix(name, "__.") {
+				this.addf("member %s is not a valid object file: %v", m.label(), err)
+			}
+		} else {
+			m.readable = m.object.format != "" && !m.object.opaque
+		}
+		this.members = append(this.members, m)
+	}
+}
+
+// readGNUIndex reads the first linker member of GNU and COFF archives, or
+// '/SYM64/', which have big endian words of wordSize bytes.
+func (this *archiveVerifier) readGNUIndex(name string, data []byte, wordSize int) {
+	if len(data) < wordSize {
+		this.addf("symbol table '%s' is truncated", name)
+		return
+	}
+	n := readWord(binary.BigEndian, data, wordSize)
+	if n < 0 || n > (len(data)-wordSize)/wordSize {
+		this.addf("symbol table '%s' has %d symbols, which do not fit in %d bytes", name, n, len(data))
+		return
+	}
+	names, ok := splitCStrings(data[wordSize*(1+n):], n)
+	if !ok {
+		this.addf("symbol table '%s' has less than %d symbol names", name, n)
+		return
+	}
+	index := &archiveIndex{name: name}
+	for i := 0; i < n; i++ {
+		index.entries = append(index.entries, archiveIndexEntry{names[i], readWord(binary.BigEndian, data[wordSize*(1+i):], wordSize)})
+	}
+	this.indices = append(this.indices, index)
+}
+
+// readCOFFIndex reads the second linker member of COFF archives, which has
+// little endian offsets of all members, and symbols sorted by name with
+// 1-based member indices.
+func (this *archiveVerifier) readCOFFIndex(data []byte) {
+	const name = "/ (second linker member)"
+	if len(data) < 4 {
+		this.addf("symbol table '%s' is truncated", name)
+		return
+	}
+	m := int(binary.LittleEndian.Uint32(data))
+	if m < 0 || m > (len(data)-8)/4 {
+		this.addf("symbol table '%s' has %d members, which do not fit in %d bytes", name, m, len(data))
+		return
+	}
+	this.coffOffsets = []int{}
+	for i := 0; i < m; i++ {
+		this.coffOffsets = append(this.coffOffsets, int(binary.LittleEndian.Uint32(data[4+4*i:])))
+	}
+	p := 4 + 4*m
+	n := int(binary.LittleEndian.Uint32(data[p:]))
+	if n < 0 || n > (len(data)-p-4)/2 {
+		this.addf("symbol table '%s' has %d symbols, which do not fit in %d bytes", name, n, len(data))
+		return
+	}
+	names, ok := splitCStrings(data[p+4+2*n:], n)
+	if !ok {
+		this.addf("symbol table '%s' has less than %d symbol names", name, n)
+		return
+	}
+	if !sort.StringsAreSorted(names) {
+		this.addf("symbol table '%s' is not sorted by name", name)
+	}
+	index := &archiveIndex{name: name}
+	for i := 0; i < n; i++ {
+		member := int(binary.LittleEndian.Uint16(data[p+4+2*i:]))
+		if member < 1 || member > m {
+			this.addf("symbol table '%s' has '%s' for member index %d out of 1-%d", name, names[i], member, m)
+			continue
+		}
+		index.entries = append(index.entries, archiveIndexEntry{names[i], this.coffOffsets[member-1]})
+	}
+	this.indices = append(this.indices, index)
+}
+
+// readBSDIndex reads '__.SYMDEF' (or '__.SYMDEF_64') of BSD archives, which
+// has ranlib structures {string offset, member offset} in the byte order of
+// the members.
+func (this *archiveVerifier) readBSDIndex(name string, data []byte) {
+	wordSize := 4
+	if strings.HasPrefix(name, "__.SYMDEF_64") {
+		wordSize = 8
+	}
+	fits := func(order binary.ByteOrder) bool {
+		if len(data) < wordSize {
+			return false
+		}
+		size := readWord(order, data, wordSize)
+		return size >= 0 && size <= len(data)-2*wordSize && size%(2*wordSize) == 0
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if !fits(order) {
+		order = binary.BigEndian
+		if !fits(order) {
+			this.addf("symbol table '%s' is truncated", name)
+			return
+		}
+	}
+	size := readWord(order, data, wordSize)
+	stringSize := readWord(order, data[wordSize+size:], wordSize)
+	start := 2*wordSize + size
+	if stringSize < 0 || stringSize > len(data)-start {
+		this.addf("symbol table '%s' has string table of %d bytes, which does not fit in %d bytes", name, stringSize, len(data))
+		return
+	}
+	table := data[start : start+stringSize]
+	index := &archiveIndex{name: name}
+	for p := wordSize; p < wordSize+size; p += 2 * wordSize {
+		symbol, err := cString(table, readWord(order, data[p:], wordSize))
+		if err != nil {
+			this.addf("symbol table '%s' has invalid symbol name: %v", name, err)
+			continue
+		}
+		index.entries = append(index.entries, archiveIndexEntry{symbol, readWord(order, data[p+wordSize:], wordSize)})
+	}
+	this.indices = append(this.indices, index)
+}
+
+func readWord(order binary.ByteOrder, b []byte, wordSize int) int {
+	if wordSize == 8 {
+		return int(order.Uint64(b))
+	}
+	return int(order.Uint32(b))
+}
+
+// splitCStrings returns first n NUL terminated strings.
+func splitCStrings(data []byte, n int) ([]string, bool) {
+	ret := []string{}
+	for len(ret) < n {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return nil, false
+		}
+		ret = append(ret, string(data[:end]))
+		data = data[end+1:]
+	}
+	return ret, true
+}
+
+// verifyIndices checks that each symbol table has every symbol defined by
+// members, and nothing else. Common symbols may be missing, since libtool
+// does not add them without '-c'.
+func (this *archiveVerifier) verifyIndices() {
+	byOffset := make(map[int]*verifiedMember)
+	for _, m := range this.members {
+		byOffset[m.offset] = m
+	}
+	if this.coffOffsets != nil {
+		if len(this.coffOffsets) != len(this.members) {
+			this.addf("symbol table '/ (second linker member)' has %d members, but the archive has %d", len(this.coffOffsets), len(this.members))
+		} else {
+			for i, m := range this.members {
+				if this.coffOffsets[i] != m.offset {
+					this.addf("symbol table '/ (second linker member)' has offset %d for member %s", this.coffOffsets[i], m.label())
+				}
+			}
+		}
+	}
+
+	if len(this.indices) == 0 {
+		for _, m := range this.members {
+			for i := range m.object.symbols {
+				if m.object.symbols[i].IsExportSymbol() {
+					this.addf("archive has no symbol table, but members define symbols")
+					return
+				}
+			}
+		}
+		return
+	}
+
+	for _, index := range this.indices {
+		indexed := make(map[*verifiedMember]*StringSet)
+		for _, entry := range index.entries {
+			m, ok := byOffset[entry.offset]
+			if !ok {
+				this.addf("symbol table '%s' has '%s' at offset %d, which is not a member", index.name, entry.symbol, entry.offset)
+				continue
+			}
+			if indexed[m] == nil {
+				indexed[m] = NewStringSet()
+			}
+			indexed[m].Put(entry.symbol)
+		}
+		for _, m := range this.members {
+			if !m.readable {
+				continue
+			}
+			defined := NewStringSet()
+			required := NewStringSet()
+			for i := range m.object.symbols {
+				sym := &m.object.symbols[i]
+				if sym.IsExportSymbol() {
+					defined.Put(sym.name)
+					// private externs may be omitted.
+					if sym.kind != 'C' && !sym.privateExtern {
+						required.Put(sym.name)
+					}
+				}
+			}
+			symbols := indexed[m]
+			if symbols == nil {
+				symbols = NewStringSet()
+			}
+			for _, symbol := range symbols.SortedValues() {
+				if !defined.Has(symbol) {
+					this.addf("symbol table '%s' has '%s' for member %s, which does not define it", index.name, symbol, m.label())
+				}
+			}
+			for _, symbol := range required.SortedValues() {
+				if !symbols.Has(symbol) {
+					this.addf("member %s defines '%s', which is not in symbol table '%s'", m.label(), symbol, index.name)
+				}
+			}
+		}
+	}
+}
+
+// verifyObject returns an error when the data is not an object file of
+// known format, or is broken.
+func verifyObject(data []byte) error {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x7fELF")):
+		f, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := f.Symbols(); err != nil && err != elf.ErrNoSymbols {
+			return err
+		}
+		return nil
+	case isMachO(data):
+		f, err := macho.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		f.Close()
+		return nil
+	case bytes.HasPrefix(data, []byte("BC\xc0\xde")):
+		return nil
+	case len(data) >= 20 && binary.LittleEndian.Uint16(data[0:2]) == 0 && binary.LittleEndian.Uint16(data[2:4]) == 0xffff:
+		if binary.LittleEndian.Uint16(data[4:6]) == 0 {
+			// short import object: header, then NUL terminated import
+			// name and DLL name.
+			size := int(binary.LittleEndian.Uint32(data[12:16]))
+			if size > len(data)-20 {
+				return fmt.Errorf("import object has %d bytes of data, but %d bytes follow the header", size, len(data)-20)
+			}
+			if _, ok := splitCStrings(data[20:20+size], 2); !ok {
+				return fmt.Errorf("import object has no import name or DLL name")
+			}
+			return nil
+		}
+		if len(data) >= 56 && bytes.Equal(data[12:28], bigobjClassID) {
+			_, err := ReadCOFFObject(data)
+			return err
+		}
+		return nil
+	case len(data) >= 20:
+		if _, ok := coffMachineNames[binary.LittleEndian.Uint16(data[0:2])]; ok {
+			_, err := ReadCOFFObject(data)
+			if err != nil {
+				// readable by debug/pe, like readCOFFObjectInfo.
+				if _, e := readCOFFObjectSymbols(data); e == nil {
+					return nil
+				}
+			}
+			return err
+		}
+	}
+	return fmt.Errorf("unknown object format")
+}
@@ -0,0 +1,182 @@
+package catlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// verifyTestArchive writes data into a temporary file, and verifies it.
+func verifyTestArchive(t *testing.T, data []byte) []string {
+	filePath := filepath.Join(t.TempDir(), "lib.a")
+	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := VerifyArchive(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return problems
+}
+
+// writeTestArchive returns a GNU archive of an object with odd size, which
+// is followed by padding and another object.
+func writeTestArchive(t *testing.T) []byte {
+	object := readTestData(t, "deplibs.o")
+	data, err := WriteArchive([]ArchiveMember{
+		{"a_very_long_member_name.o", append(append([]byte{}, object...), 0)},
+		{"b.o", object},
+	}, ArchiveFormatGNU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func hasProblem(problems []string, substr string) bool {
+	for _, problem := range problems {
+		if strings.Contains(problem, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestVerifyArchive(t *testing.T) {
+	for _, format := range []string{ArchiveFormatGNU, ArchiveFormatCOFF, ArchiveFormatBSD} {
+		object := readTestData(t, "linker_option.o")
+		data, err := WriteArchive([]ArchiveMember{
+			{"a_very_long_member_name.o", append(append([]byte{}, object...), 0)},
+			{"b.o", object},
+		}, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems := verifyTestArchive(t, data); len(problems) > 0 {
+			t.Errorf("%s: %q", format, problems)
+		}
+	}
+	if problems := verifyTestArchive(t, writeTestArchive(t)); len(problems) > 0 {
+		t.Errorf("%q", problems)
+	}
+
+	filePath := filepath.Join(t.TempDir(), "x.o")
+	if err := ioutil.WriteFile(filePath, readTestData(t, "deplibs.o"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyArchive(filePath); err == nil {
+		t.Errorf("object file is verified as an archive")
+	}
+}
+
+func TestVerifyArchiveBroken(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+		problem string
+	}{
+		{"bad padding", func(data []byte) []byte {
+			// the padding precedes the header of 'b.o'.
+			data[bytes.Index(data, []byte("\nb.o/"))] = 'x'
+			return data
+		}, "is padded with 0x78 instead of '\\n'"},
+		{"wrong symbol offset", func(data []byte) []byte {
+			// offset of the first symbol in '/', following the symbol count.
+			p := 8 + 60 + 4
+			binary.BigEndian.PutUint32(data[p:], binary.BigEndian.Uint32(data[p:])+2)
+			return data
+		}, "which is not a member"},
+		{"truncated member", func(data []byte) []byte {
+			return data[:len(data)-100]
+		}, "but the file has"},
+		{"truncated header", func(data []byte) []byte {
+			return append(data, "b.o/"...)
+		}, "is truncated"},
+		{"invalid size", func(data []byte) []byte {
+			i := bytes.Index(data, []byte("b.o/")) + 48
+			copy(data[i:], "12x4      ")
+			return data
+		}, "has invalid size '12x4'"},
+		{"member without symbols in the index", func(data []byte) []byte {
+			// 'f' of the first member is renamed to 'g' in '/'.
+			i := bytes.Index(data[8+60:], []byte("f\x00")) + 8 + 60
+			data[i] = 'g'
+			return data
+		}, "defines 'f', which is not in symbol table '/'"},
+	}
+	for _, test := range tests {
+		problems := verifyTestArchive(t, test.corrupt(writeTestArchive(t)))
+		if !hasProblem(problems, test.problem) {
+			t.Errorf("%s: %q does not have '%s'", test.name, problems, test.problem)
+		}
+	}
+}
+
+// '__.SYMDEF' may or may not have Mach-O private externs.
+func TestVerifyArchivePrivateExtern(t *testing.T) {
+	object := readTestData(t, "private_extern.o")
+	tests := []struct {
+		symbols []string
+		problem string
+	}{
+		{[]string{"_pub", "_priv"}, ""},
+		{[]string{"_pub"}, ""},
+		{[]string{"_priv"}, "defines '_pub', which is not in symbol table '__.SYMDEF'"},
+		{[]string{"_pub", "_nosuch"}, "has '_nosuch' for member"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		buf.WriteString("!<arch>\n")
+		names := []byte{}
+		symdef := make([]byte, 4+8*len(test.symbols)+4)
+		binary.LittleEndian.PutUint32(symdef, uint32(8*len(test.symbols)))
+		for i, symbol := range test.symbols {
+			binary.LittleEndian.PutUint32(symdef[4+8*i:], uint32(len(names)))
+			names = append(append(names, symbol...), 0)
+		}
+		binary.LittleEndian.PutUint32(symdef[4+8*len(test.symbols):], uint32(len(names)))
+		symdefOffset := writeBSDArchiveMember(&buf, "__.SYMDEF", 0, append(symdef, names...))
+		memberOffset := buf.Len()
+		writeBSDArchiveMember(&buf, "x.o", 0644, object)
+		data := buf.Bytes()
+		for i := range test.symbols {
+			binary.LittleEndian.PutUint32(data[symdefOffset+8+8*i:], uint32(memberOffset))
+		}
+
+		problems := verifyTestArchive(t, data)
+		if test.problem == "" && len(problems) > 0 {
+			t.Errorf("%q: %q", test.symbols, problems)
+		}
+		if test.problem != "" && !hasProblem(problems, test.problem) {
+			t.Errorf("%q: %q does not have '%s'", test.symbols, problems, test.problem)
+		}
+	}
+}
+
+// weak externals with a defined default are definitions, which symbol tables
+// have.
+func TestVerifyArchiveWeakExternal(t *testing.T) {
+	for _, format := range []string{ArchiveFormatGNU, ArchiveFormatCOFF} {
+		data, err := WriteArchive([]ArchiveMember{{"weak.obj", weakExternalObject()}}, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems := verifyTestArchive(t, data); len(problems) > 0 {
+			t.Errorf("%s: %q", format, problems)
+		}
+	}
+
+	data, err := WriteArchive([]ArchiveMember{{"weak.obj", weakExternalObject()}}, ArchiveFormatGNU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 'w' is renamed to 'v' in '/'.
+	i := bytes.Index(data[8+60:], []byte("\x00w\x00")) + 8 + 60 + 1
+	data[i] = 'v'
+	if problems := verifyTestArchive(t, data); !hasProblem(problems, "defines 'w', which is not in symbol table '/'") {
+		t.Errorf("%q", problems)
+	}
+}
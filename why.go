@@ -0,0 +1,128 @@
+package catlib
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Reference is a reference to Symbol from member From, which is resolved by
+// member To.
+type Reference struct {
+	From   *PlanMember
+	Symbol string
+	To     *PlanMember
+}
+
+// Why returns the shortest chain of references from a root member to the
+// target, which is either a symbol name or a member in "lib:member" form.
+// Root members are base members and members included unconditionally, so
+// the chain is empty when the target is a root member.
+func (this *Plan) Why(target string) ([]Reference, error) {
+	goal := this.FindMember(target)
+	if goal == nil {
+		for _, sym := range this.Unresolved {
+			if sym == target {
+				return nil, fmt.Errorf("'%s' is not resolved", target)
+			}
+		}
+		return nil, fmt.Errorf("'%s' is neither a member nor a symbol defined by members", target)
+	}
+	if goal.IsRoot() {
+		return []Reference{}, nil
+	}
+
+	edges := make(map[*PlanMember][]*PlanEdge)
+	for _, edge := range this.Edges {
+		edges[edge.From] = append(edges[edge.From], edge)
+	}
+
+	// breadth first search from all root members.
+	via := make(map[*PlanMember]*PlanEdge)
+	queue := []*PlanMember{}
+	for _, member := range this.Members() {
+		if member.IsRoot() {
+			via[member] = nil
+			queue = append(queue, member)
+		}
+	}
+	for len(queue) > 0 {
+		member := queue[0]
+		queue = queue[1:]
+		if member == goal {
+			break
+		}
+		for _, edge := range edges[member] {
+			if _, visited := via[edge.To]; visited {
+				continue
+			}
+			via[edge.To] = edge
+			queue = append(queue, edge.To)
+		}
+	}
+
+	if _, ok := via[goal]; !ok {
+		return nil, fmt.Errorf("'%s' is not reachable from root members", target)
+	}
+	ret := []Reference{}
+	for member := goal; via[member] != nil; member = via[member].From {
+		edge := via[member]
+		ret = append([]Reference{{edge.From, edge.Symbols[0], edge.To}}, ret...)
+	}
+	return ret, nil
+}
+
+// FindMember finds a member by "lib:member" form, or by a symbol defined by
+// a member.
+func (this *Plan) FindMember(target string) *PlanMember {
+	for _, member := range this.Members() {
+		library := filepath.Base(member.Library)
+		libraryNames := []string{member.Library, library, strings.TrimSuffix(library, filepath.Ext(library))}
+		memberNames := []string{member.Name, filepath.Base(member.Name)}
+		for _, l := range libraryNames {
+			for _, m := range memberNames {
+				if target == l+":"+m {
+					return member
+				}
+			}
+		}
+	}
+	for _, member := range this.Members() {
+		for _, sym := range member.Exports {
+			if sym == target {
+				return member
+			}
+		}
+	}
+	return nil
+}
+
+// IsRoot returns true when the member is included regardless of references
+// from other members.
+func (this *PlanMember) IsRoot() bool {
+	return this.IsBase() || (this.Reason != "" && this.Reason != PullReasonSymbol)
+}
+
+// Label returns the member name, prefixed by its library name unless it is
+// a base member.
+func (this *PlanMember) Label() string {
+	if this.IsBase() {
+		return this.Name
+	}
+	library := filepath.Base(this.Library)
+	return strings.TrimSuffix(library, filepath.Ext(library)) + ":" + this.Name
+}
+
+// FormatReferences formats a chain of references as
+// "base.obj needs inflate -> zlib:inflate.obj needs zcalloc -> zlib:zutil.obj".
+func FormatReferences(chain []Reference) string {
+	if len(chain) == 0 {
+		return ""
+	}
+	parts := []string{}
+	for _, ref := range chain {
+		parts = append(parts, fmt.Sprintf("%s needs %s", ref.From.Label(), ref.Symbol))
+	}
+	parts = append(parts, chain[len(chain)-1].To.Label())
+	return strings.Join(parts, " -> ")
+}
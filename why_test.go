@@ -0,0 +1,61 @@
+package catlib
+
+import "testing"
+
+func TestWhy(t *testing.T) {
+	plan := testPlan()
+	tests := []struct {
+		target string
+		chain  string
+	}{
+		{"zcfree", "base.o needs inflate -> z:inflate.o needs zcalloc -> z:zutil.o"},
+		{"z:zutil.o", "base.o needs inflate -> z:inflate.o needs zcalloc -> z:zutil.o"},
+		{"z.lib:zutil.o", "base.o needs inflate -> z:inflate.o needs zcalloc -> z:zutil.o"},
+		{"/work/z.lib:inflate.o", "base.o needs inflate -> z:inflate.o"},
+		{"main", ""},
+	}
+	for _, test := range tests {
+		chain, err := plan.Why(test.target)
+		if err != nil {
+			t.Errorf("%s: %v", test.target, err)
+			continue
+		}
+		if got := FormatReferences(chain); got != test.chain {
+			t.Errorf("%s: '%s', want '%s'", test.target, got, test.chain)
+		}
+	}
+
+	for _, target := range []string{"malloc", "nosuch", "z:nosuch.o"} {
+		if _, err := plan.Why(target); err == nil {
+			t.Errorf("%s: no error", target)
+		}
+	}
+}
+
+// the chain starts from the nearest root member, including members pulled
+// unconditionally.
+func TestWhyShortest(t *testing.T) {
+	plan := testPlan()
+	whole := &PlanMember{Library: "/work/z.lib", Name: "whole.o", Reason: PullReasonWholeArchive, Imports: []string{"zcfree"}}
+	plan.Pulled = append(plan.Pulled, whole)
+	plan.Edges = append(plan.Edges, &PlanEdge{From: whole, To: plan.Pulled[1], Symbols: []string{"zcfree"}})
+
+	chain, err := plan.Why("z:zutil.o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := FormatReferences(chain), "z:whole.o needs zcfree -> z:zutil.o"; got != want {
+		t.Errorf("'%s', want '%s'", got, want)
+	}
+	if chain, err := plan.Why("z:whole.o"); err != nil || len(chain) != 0 {
+		t.Errorf("root member has chain %v, %v", chain, err)
+	}
+}
+
+func TestWhyUnreachable(t *testing.T) {
+	plan := testPlan()
+	plan.Edges = plan.Edges[:1]
+	if _, err := plan.Why("z:zutil.o"); err == nil {
+		t.Errorf("unreachable member has chain")
+	}
+}